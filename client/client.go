@@ -0,0 +1,298 @@
+// Package client is a client of the game API of chesstempo, as described by
+// its OpenAPI specification (see http.Spec).
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Error codes returned by the API.
+const (
+	CodeInternal        = "internal"
+	CodeInvalidRequest  = "invalid_request"
+	CodeInvalidArgument = "invalid_argument"
+	CodeNotFound        = "not_found"
+	CodeAlreadyExists   = "already_exists"
+	CodeQueryRejected   = "query_rejected"
+	CodeGameInProgress  = "game_in_progress"
+	CodeGameOver        = "game_over"
+	CodeNotYourTurn     = "not_your_turn"
+	CodeUnknownEngine   = "unknown_engine"
+	CodeUnavailable     = "unavailable"
+	CodeTimeout         = "timeout"
+	CodeUnauthorized    = "unauthorized"
+	CodeLimitExceeded   = "limit_exceeded"
+)
+
+// Error is an error returned by the API.
+type Error struct {
+	Status int    `json:"status"`
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (%s)", e.Reason, e.Code)
+}
+
+// StartGameRequest describes a new game. The zero value starts a live game
+// from the initial position where the user plays a random color.
+type StartGameRequest struct {
+	Color          string                  `json:"color,omitempty"` // "w" or "b".
+	FEN            string                  `json:"fen,omitempty"`
+	Mode           string                  `json:"mode,omitempty"` // "live" or "correspondence".
+	Correspondence *CorrespondenceSettings `json:"correspondence,omitempty"`
+	Engine         string                  `json:"engine,omitempty"`
+}
+
+type CorrespondenceSettings struct {
+	DaysPerMove  int `json:"daysPerMove"`
+	VacationDays int `json:"vacationDays"`
+	Notify       struct {
+		Email   string `json:"email,omitempty"`
+		Webhook string `json:"webhook,omitempty"`
+	} `json:"notify"`
+}
+
+// Game is the state of a game.
+type Game struct {
+	FEN        string     `json:"FEN"`
+	StartFEN   string     `json:"StartFEN,omitempty"`
+	Outcome    string     `json:"Outcome"` // "*" while in progress.
+	Method     int        `json:"Method"`
+	Board      string     `json:"Board"`
+	Moves      []string   `json:"Moves"`
+	Turn       string     `json:"Turn"`  // "User" or "Machine".
+	Color      string     `json:"Color"` // Color of the user, "White" or "Black".
+	ValidMoves []string   `json:"ValidMoves"`
+	ParentID   string     `json:"ParentID,omitempty"`
+	Series     *Series    `json:"Series,omitempty"`
+	Mode       string     `json:"Mode,omitempty"`
+	Engine     string     `json:"Engine,omitempty"`
+	AbandonAt  *time.Time `json:"AbandonAt,omitempty"`
+	Abandoned  bool       `json:"Abandoned,omitempty"`
+	Deadline   *time.Time `json:"Deadline,omitempty"`
+	Vacation   int        `json:"Vacation,omitempty"`
+	TimedOut   bool       `json:"TimedOut,omitempty"`
+}
+
+// InProgress reports whether the game has not finished yet.
+func (g *Game) InProgress() bool {
+	return g.Outcome == "*"
+}
+
+// Series is the score of a series of rematches.
+type Series struct {
+	Games      []string `json:"games"`
+	User       float64  `json:"user"`
+	Machine    float64  `json:"machine"`
+	Current    string   `json:"current,omitempty"`
+	InProgress bool     `json:"inProgress,omitempty"`
+}
+
+type Client struct {
+	// Addr is the base URL of the server, e.g. http://127.0.0.1:9999.
+	Addr string
+
+	// Notation of the moves of the games: uci (default), san or lan. The
+	// notation of the moves sent is always detected by the server.
+	Notation string
+
+	// Token authenticates the requests of a remote bot, see RegisterBot.
+	Token string
+
+	HTTPClient *http.Client
+}
+
+func New(addr string) *Client {
+	return &Client{
+		Addr:       strings.TrimSuffix(addr, "/"),
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// ListGames returns the identifiers of the games in progress.
+func (c *Client) ListGames(ctx context.Context) ([]string, error) {
+	var ret []string
+	err := c.do(ctx, http.MethodGet, "/api/games", nil, &ret)
+	return ret, err
+}
+
+// StartGame starts a game and returns its identifier.
+func (c *Client) StartGame(ctx context.Context, req StartGameRequest) (string, error) {
+	ret := struct {
+		ID string `json:"id"`
+	}{}
+	err := c.do(ctx, http.MethodPost, "/api/games", req, &ret)
+	return ret.ID, err
+}
+
+// Game returns the state of a game.
+func (c *Client) Game(ctx context.Context, id string) (*Game, error) {
+	ret := &Game{}
+	if err := c.do(ctx, http.MethodGet, c.withNotation(gamePath(id)), nil, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Move makes a move in the user's turn in SAN, UCI or long algebraic notation.
+// Moves are played asynchronously, the state of the game is updated once the
+// game receives it.
+func (c *Client) Move(ctx context.Context, id, move string) error {
+	return c.do(ctx, http.MethodPost, gamePath(id, "move", move), nil, nil)
+}
+
+// Resign resigns a game.
+func (c *Client) Resign(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPost, gamePath(id, "resign"), nil, nil)
+}
+
+// Vacation extends the deadline of a correspondence game.
+func (c *Client) Vacation(ctx context.Context, id string, days int) error {
+	req := struct {
+		Days int `json:"days"`
+	}{days}
+	return c.do(ctx, http.MethodPost, gamePath(id, "vacation"), req, nil)
+}
+
+// Rematch starts the rematch of a finished game and returns its identifier.
+func (c *Client) Rematch(ctx context.Context, id string) (string, error) {
+	ret := struct {
+		ID string `json:"id"`
+	}{}
+	err := c.do(ctx, http.MethodPost, gamePath(id, "rematch"), nil, &ret)
+	return ret.ID, err
+}
+
+// Series returns the score of the series that includes a game.
+func (c *Client) Series(ctx context.Context, id string) (*Series, error) {
+	ret := &Series{}
+	if err := c.do(ctx, http.MethodGet, gamePath(id, "series"), nil, ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// MoveRequest is a position where a remote bot has to move before the
+// deadline.
+type MoveRequest struct {
+	ID       string    `json:"id"`
+	GameID   string    `json:"gameId"`
+	FEN      string    `json:"fen"`
+	Deadline time.Time `json:"deadline"`
+}
+
+// RegisterBot registers a remote bot, games that request the engine with the
+// same name are played by it. New bots are given a token, returned only once,
+// which must be set in Token to play as the bot or to register it again.
+func (c *Client) RegisterBot(ctx context.Context, name string) (token string, err error) {
+	var ret struct {
+		Token string `json:"token"`
+	}
+	if err := c.do(ctx, http.MethodPut, botPath(name), nil, &ret); err != nil {
+		return "", err
+	}
+	return ret.Token, nil
+}
+
+// UnregisterBot unregisters a remote bot.
+func (c *Client) UnregisterBot(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, botPath(name), nil, nil)
+}
+
+// NextMoveRequest waits up to wait for the next position where the bot has to
+// move. It returns nil when there is none.
+func (c *Client) NextMoveRequest(ctx context.Context, name string, wait time.Duration) (*MoveRequest, error) {
+	path := botPath(name, "next") + fmt.Sprintf("?wait=%d", int(wait.Seconds()))
+	var ret *MoveRequest
+	if err := c.do(ctx, http.MethodGet, path, nil, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// BotMove sends the move of the bot in UCI notation.
+func (c *Client) BotMove(ctx context.Context, name, requestID, move string) error {
+	return c.do(ctx, http.MethodPost, botPath(name, "requests", requestID, "move", move), nil, nil)
+}
+
+func botPath(name string, elems ...string) string {
+	path := "/api/bots/" + url.PathEscape(name)
+	for _, elem := range elems {
+		path += "/" + url.PathEscape(elem)
+	}
+	return path
+}
+
+func gamePath(id string, elems ...string) string {
+	path := "/api/games/" + url.PathEscape(id)
+	for _, elem := range elems {
+		path += "/" + url.PathEscape(elem)
+	}
+	return path
+}
+
+func (c *Client) withNotation(path string) string {
+	if c.Notation == "" {
+		return path
+	}
+	return path + "?notation=" + url.QueryEscape(c.Notation)
+}
+
+// do sends a request with the payload encoded as JSON, if any, and decodes
+// the response into ret unless it is nil. Errors of the API are returned as
+// *Error.
+func (c *Client) do(ctx context.Context, method, path string, payload, ret interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		blob, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(blob)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.Addr+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		apiErr := &Error{Status: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(apiErr); err != nil || apiErr.Code == "" {
+			return &Error{Status: resp.StatusCode, Code: CodeInternal, Reason: http.StatusText(resp.StatusCode)}
+		}
+		return apiErr
+	}
+
+	if ret == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(ret); err != nil {
+		return fmt.Errorf("error decoding response: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+
+	"github.com/sevein/chesstempo/client"
+	chesshttp "github.com/sevein/chesstempo/http"
+)
+
+// newServer returns a server that validates the requests against the spec of
+// the API and replies with the given response.
+func newServer(t *testing.T, status int, resp interface{}) *httptest.Server {
+	t.Helper()
+
+	doc, err := openapi3.NewLoader().LoadFromData(chesshttp.Spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, params, err := router.FindRoute(r)
+		if err != nil {
+			t.Errorf("%s %s: %v", r.Method, r.URL, err)
+			return
+		}
+		input := &openapi3filter.RequestValidationInput{Request: r, PathParams: params, Route: route}
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			t.Errorf("%s %s: %v", r.Method, r.URL, err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestClient(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	ok := map[string]bool{"OK": true}
+
+	t.Run("StartGame", func(t *testing.T) {
+		reqs := []client.StartGameRequest{
+			{Color: "w", Mode: "correspondence", Correspondence: &client.CorrespondenceSettings{DaysPerMove: 3}},
+			{Color: "b", Engine: "strong"},
+		}
+		for _, req := range reqs {
+			c := client.New(newServer(t, http.StatusOK, map[string]string{"id": "12345"}).URL)
+			id, err := c.StartGame(ctx, req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != "12345" {
+				t.Fatalf("unexpected id: %q", id)
+			}
+		}
+	})
+
+	t.Run("Game", func(t *testing.T) {
+		c := client.New(newServer(t, http.StatusOK, map[string]interface{}{
+			"FEN":        "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+			"Outcome":    "*",
+			"Moves":      []string{"e2e4"},
+			"Turn":       "Machine",
+			"ValidMoves": nil,
+		}).URL)
+		game, err := c.Game(ctx, "12345")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !game.InProgress() || len(game.Moves) != 1 || game.Turn != "Machine" {
+			t.Fatalf("unexpected game: %+v", game)
+		}
+	})
+
+	t.Run("Actions", func(t *testing.T) {
+		c := client.New(newServer(t, http.StatusOK, ok).URL)
+		if err := c.Move(ctx, "12345", "e7e8q"); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Resign(ctx, "12345"); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Vacation(ctx, "12345", 2); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		c := client.New(newServer(t, http.StatusNotFound, map[string]interface{}{
+			"status": http.StatusNotFound,
+			"code":   client.CodeNotFound,
+			"reason": "Game not found.",
+		}).URL)
+		_, err := c.Game(ctx, "12345")
+
+		var apiErr *client.Error
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if apiErr.Status != http.StatusNotFound || apiErr.Code != client.CodeNotFound {
+			t.Fatalf("unexpected error: %+v", apiErr)
+		}
+	})
+}
+
+// TestSpec decodes the examples of the spec of the API with the types of the
+// client, so they do not drift apart.
+func TestSpec(t *testing.T) {
+	t.Parallel()
+
+	doc, err := openapi3.NewLoader().LoadFromData(chesshttp.Spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	examples := map[string]struct {
+		example interface{}
+		ret     interface{}
+	}{
+		"Game":        {doc.Components.Schemas["Game"].Value.Example, &client.Game{}},
+		"MoveRequest": {doc.Components.Schemas["MoveRequest"].Value.Example, &client.MoveRequest{}},
+		"Error":       {doc.Components.Schemas["Error"].Value.Example, &client.Error{}},
+		"readSeries":  {doc.Paths.Find("/api/games/{id}/series").Get.Responses.Get(http.StatusOK).Value.Content.Get("application/json").Example, &client.Series{}},
+	}
+	for name, tc := range examples {
+		if tc.example == nil {
+			t.Errorf("%s: no example", name)
+			continue
+		}
+		blob, err := json.Marshal(tc.example)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dec := json.NewDecoder(bytes.NewReader(blob))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(tc.ret); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		// Encoded again, every field of the example is kept.
+		got := map[string]interface{}{}
+		if blob, err = json.Marshal(tc.ret); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(blob, &got); err != nil {
+			t.Fatal(err)
+		}
+		for key, want := range tc.example.(map[string]interface{}) {
+			if want == nil || reflect.ValueOf(want).IsZero() {
+				continue
+			}
+			if _, ok := got[key]; !ok {
+				t.Errorf("%s: field %s is lost", name, key)
+			}
+		}
+	}
+
+	// Every property of the game is in its example.
+	game := doc.Components.Schemas["Game"].Value
+	for key := range game.Properties {
+		if _, ok := game.Example.(map[string]interface{})[key]; !ok {
+			t.Errorf("Game: property %s has no example", key)
+		}
+	}
+
+	// Codes of the errors.
+	want := map[string]bool{}
+	for _, code := range doc.Components.Schemas["Error"].Value.Properties["code"].Value.Enum {
+		want[code.(string)] = true
+	}
+	codes := map[string]string{
+		client.CodeInternal:        chesshttp.ErrInternal,
+		client.CodeInvalidRequest:  chesshttp.ErrInvalidRequest,
+		client.CodeInvalidArgument: chesshttp.ErrInvalidArgument,
+		client.CodeNotFound:        chesshttp.ErrNotFound,
+		client.CodeAlreadyExists:   chesshttp.ErrAlreadyExists,
+		client.CodeQueryRejected:   chesshttp.ErrQueryRejected,
+		client.CodeGameInProgress:  chesshttp.ErrGameInProgress,
+		client.CodeGameOver:        chesshttp.ErrGameOver,
+		client.CodeNotYourTurn:     chesshttp.ErrNotYourTurn,
+		client.CodeUnknownEngine:   chesshttp.ErrUnknownEngine,
+		client.CodeUnavailable:     chesshttp.ErrUnavailable,
+		client.CodeTimeout:         chesshttp.ErrTimeout,
+		client.CodeUnauthorized:    chesshttp.ErrUnauthorized,
+		client.CodeLimitExceeded:   chesshttp.ErrLimitExceeded,
+	}
+	for code, serverCode := range codes {
+		if code != serverCode || !want[code] {
+			t.Errorf("code %q: server %q, in spec %v", code, serverCode, want[code])
+		}
+	}
+	if len(codes) != len(want) {
+		t.Errorf("client has %d codes, spec has %d", len(codes), len(want))
+	}
+}
@@ -0,0 +1,158 @@
+// Command chesstempo-bot plays as the machine using a local engine. It
+// registers itself as a remote bot and long-polls the server for positions.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sevein/chesstempo/client"
+	"github.com/sevein/chesstempo/game"
+)
+
+const usage = `Usage:
+    chesstempo-bot [-addr URL] -name NAME [-token TOKEN] [-engine PATH] [-protocol uci|cecp] [-movetime DURATION]
+
+Games play against the bot when they request the engine NAME, e.g.
+chesstempo-cli play -engine NAME. The address of the server can also be set
+with CHESSTEMPO_ADDR.
+
+The bot is given a token when it is registered for the first time, which is
+printed and required to play as the bot again while it is registered, e.g.
+after a crash. It can also be set with CHESSTEMPO_BOT_TOKEN.
+`
+
+// margin is subtracted from the deadline of the requests to leave time for
+// the move to reach the server.
+const margin = time.Second / 2
+
+func main() {
+	flag.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", usage) }
+
+	addr := os.Getenv("CHESSTEMPO_ADDR")
+	if addr == "" {
+		addr = "http://127.0.0.1:9999"
+	}
+	var (
+		name     string
+		token    string
+		engine   string
+		protocol string
+		moveTime time.Duration
+	)
+	flag.StringVar(&addr, "addr", addr, "address of the chesstempo server")
+	flag.StringVar(&name, "name", "", "name of the bot")
+	flag.StringVar(&token, "token", os.Getenv("CHESSTEMPO_BOT_TOKEN"), "token of the bot")
+	flag.StringVar(&engine, "engine", "", "engine executable, defaults to stockfish")
+	flag.StringVar(&protocol, "protocol", "uci", "engine protocol (uci or cecp)")
+	flag.DurationVar(&moveTime, "movetime", time.Second*2, "maximum search time per move")
+	flag.Parse()
+
+	if name == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := client.New(addr)
+	c.Token = token
+	if err := run(ctx, c, name, engine, protocol, moveTime); err != nil {
+		fmt.Fprintf(os.Stderr, "chesstempo-bot: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, c *client.Client, name, engine, protocol string, moveTime time.Duration) error {
+	path, err := game.FindEngine(engine)
+	if err != nil {
+		return err
+	}
+	p, err := game.ParseProtocol(protocol)
+	if err != nil {
+		return err
+	}
+	bot, err := game.NewBot(game.EngineConfig{Path: path, Protocol: p})
+	if err != nil {
+		return fmt.Errorf("error starting engine: %v", err)
+	}
+	defer bot.Stop()
+
+	if err := register(ctx, c, name); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Registered as %q, waiting for positions.\n", name)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		_ = c.UnregisterBot(ctx, name)
+	}()
+
+	for {
+		req, err := c.NextMoveRequest(ctx, name, time.Second*30)
+		if ctx.Err() != nil {
+			return nil
+		}
+		var apiErr *client.Error
+		if errors.As(err, &apiErr) && apiErr.Code == client.CodeNotFound {
+			// The server forgot the bot, register again.
+			if err := register(ctx, c, name); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error waiting for positions: %v\n", err)
+			select {
+			case <-time.After(time.Second * 5):
+			case <-ctx.Done():
+				return nil
+			}
+			continue
+		}
+		if req == nil {
+			continue
+		}
+
+		dur := moveTime
+		if left := time.Until(req.Deadline) - margin; left < dur {
+			dur = left
+		}
+		if dur <= 0 {
+			continue
+		}
+		move, err := bot.Play(ctx, req.FEN, dur, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error searching %s: %v\n", req.FEN, err)
+			continue
+		}
+		if err := c.BotMove(ctx, name, req.ID, move.String()); err != nil {
+			fmt.Fprintf(os.Stderr, "Error sending move %s in game %s: %v\n", move, req.GameID, err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Played %s in game %s.\n", move, req.GameID)
+	}
+}
+
+// register registers the bot and keeps its token, if new.
+func register(ctx context.Context, c *client.Client, name string) error {
+	token, err := c.RegisterBot(ctx, name)
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) && apiErr.Code == client.CodeUnauthorized {
+		return fmt.Errorf("bot %q is registered, set its token with -token", name)
+	} else if err != nil {
+		return fmt.Errorf("error registering bot: %v", err)
+	}
+	if token != "" {
+		c.Token = token
+		fmt.Fprintf(os.Stderr, "Token of the bot: %s\n", token)
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sevein/chesstempo/client"
+)
+
+const usage = `Usage:
+    chesstempo-cli [-addr URL] <command> [arguments]
+
+Commands:
+    start [-color w|b] [-fen FEN] [-mode live|correspondence] [-engine NAME] [-demo]
+    play [-color w|b] [-fen FEN] [-engine NAME] [ID]
+    list
+    info ID
+    move ID MOVE
+    resign ID
+    resign-all
+
+Moves are accepted in SAN (e.g. Nf3), UCI (e.g. g1f3) or long algebraic
+notation, and shown in SAN. The address of the server can also be set with
+CHESSTEMPO_ADDR.
+`
+
+// demoFEN is the position of the final decisive game of the 2014 Carlsen vs.
+// Anand World Championship match.
+const demoFEN = "8/4b3/4P3/1k4P1/8/ppK5/8/4R3 b - - 1 45"
+
+func main() {
+	flag.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", usage) }
+
+	addr := os.Getenv("CHESSTEMPO_ADDR")
+	if addr == "" {
+		addr = "http://127.0.0.1:9999"
+	}
+	flag.StringVar(&addr, "addr", addr, "address of the chesstempo server")
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := client.New(addr)
+	c.Notation = "san"
+	if err := run(ctx, c, flag.Arg(0), flag.Args()[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "chesstempo-cli: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, c *client.Client, cmd string, args []string) error {
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+
+	var (
+		req  client.StartGameRequest
+		demo bool
+	)
+	if cmd == "start" || cmd == "play" {
+		fs.StringVar(&req.Color, "color", "", "color of the user (w or b), random if empty")
+		fs.StringVar(&req.FEN, "fen", "", "initial position")
+		fs.StringVar(&req.Engine, "engine", "", "engine playing the machine's side")
+	}
+	if cmd == "start" {
+		fs.StringVar(&req.Mode, "mode", "", "live or correspondence")
+		fs.BoolVar(&demo, "demo", false, "start from a famous endgame")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	args = fs.Args()
+
+	arg := func(i int, name string) (string, error) {
+		if len(args) <= i {
+			return "", fmt.Errorf("%s: missing %s", cmd, name)
+		}
+		return args[i], nil
+	}
+
+	switch cmd {
+	case "start":
+		if demo && req.FEN == "" {
+			req.FEN = demoFEN
+		}
+		id, err := c.StartGame(ctx, req)
+		if err != nil {
+			return err
+		}
+		fmt.Println(id)
+
+	case "play":
+		id := fs.Arg(0)
+		if id == "" {
+			var err error
+			if id, err = c.StartGame(ctx, req); err != nil {
+				return err
+			}
+		}
+		return play(ctx, c, id, os.Stdin, os.Stdout)
+
+	case "list":
+		ids, err := c.ListGames(ctx)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			fmt.Println(id)
+		}
+
+	case "info":
+		id, err := arg(0, "game ID")
+		if err != nil {
+			return err
+		}
+		game, err := c.Game(ctx, id)
+		if err != nil {
+			return err
+		}
+		draw(os.Stdout, id, game)
+
+	case "move":
+		id, err := arg(0, "game ID")
+		if err != nil {
+			return err
+		}
+		move, err := arg(1, "move")
+		if err != nil {
+			return err
+		}
+		return c.Move(ctx, id, move)
+
+	case "resign":
+		id, err := arg(0, "game ID")
+		if err != nil {
+			return err
+		}
+		return c.Resign(ctx, id)
+
+	case "resign-all":
+		ids, err := c.ListGames(ctx)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := c.Resign(ctx, id); err != nil {
+				return fmt.Errorf("%s: %v", id, err)
+			}
+			fmt.Println("Resigned", id)
+		}
+
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+
+	return nil
+}
+
+// play follows the game until it is over, reading the moves of the user from
+// in. The board is redrawn every time the game changes.
+func play(ctx context.Context, c *client.Client, id string, in io.Reader, out io.Writer) error {
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			lines <- strings.TrimSpace(scanner.Text())
+		}
+		close(lines)
+	}()
+
+	ticker := time.NewTicker(time.Second / 2)
+	defer ticker.Stop()
+
+	var (
+		last string
+		msg  string
+	)
+	for {
+		game, err := c.Game(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if state := game.FEN + game.Outcome + game.Turn + msg; state != last {
+			last = state
+			fmt.Fprint(out, "\033[H\033[2J")
+			draw(out, id, game)
+			if msg != "" {
+				fmt.Fprintln(out, msg)
+			}
+			if !game.InProgress() {
+				return nil
+			}
+			if game.Turn == "User" {
+				fmt.Fprint(out, "Your move (or resign, quit): ")
+			} else {
+				fmt.Fprintln(out, "Waiting for the machine...")
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(out)
+			return nil
+		case line, ok := <-lines:
+			switch {
+			case !ok, line == "quit", line == "q":
+				fmt.Fprintf(out, "\nContinue with: chesstempo-cli play %s\n", id)
+				return nil
+			case line == "":
+				msg = ""
+			case line == "resign":
+				if err := c.Resign(ctx, id); err != nil {
+					return err
+				}
+				msg = "Resigned."
+			default:
+				var apiErr *client.Error
+				if err := c.Move(ctx, id, line); errors.As(err, &apiErr) {
+					msg = apiErr.Reason
+				} else if err != nil {
+					return err
+				} else {
+					msg = ""
+				}
+			}
+			last = "" // Prompt again.
+		case <-ticker.C:
+		}
+	}
+}
+
+func draw(out io.Writer, id string, game *client.Game) {
+	fmt.Fprintln(out, game.Board)
+	fmt.Fprintf(out, "Game: %s\n", id)
+	fmt.Fprintf(out, "You play: %s\n", game.Color)
+	if n := len(game.Moves); n > 0 {
+		fmt.Fprintf(out, "Last move: %s\n", game.Moves[n-1])
+	}
+	if game.Deadline != nil {
+		fmt.Fprintf(out, "Deadline: %s\n", game.Deadline.Local().Format(time.RFC1123))
+	}
+	if !game.InProgress() {
+		fmt.Fprintf(out, "Outcome: %s\n", game.Outcome)
+	}
+}
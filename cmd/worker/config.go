@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sevein/chesstempo/game"
+)
+
+// Config is the configuration file of the worker, e.g.:
+//
+//	engines:
+//	  default:
+//	    path: stockfish
+//	  strong:
+//	    path: /usr/games/stockfish
+//	    options: {Threads: 4, Hash: 1024, SyzygyPath: /var/lib/syzygy}
+//	    movetime: 2s
+//	  gnuchess:
+//	    path: gnuchess
+//	    args: [--xboard]
+//	    protocol: cecp
+type Config struct {
+	Engines map[string]Profile `yaml:"engines"`
+}
+
+// Profile is an engine served by the worker in its own task queue. Games
+// request the profile by its name, listed under engine.engines in the server.
+type Profile struct {
+	Path      string            `yaml:"path"`     // Defaults to Stockfish.
+	Args      []string          `yaml:"args"`     // CECP engines only.
+	Protocol  string            `yaml:"protocol"` // uci (default) or cecp.
+	Options   map[string]string `yaml:"options"`
+	MoveTime  time.Duration     `yaml:"movetime"`
+	TaskQueue string            `yaml:"task-queue"` // Defaults to game.EngineQueue(NAME).
+}
+
+// readConfig reads the configuration file and sets the defaults of the
+// profiles.
+func readConfig(path string) (*Config, error) {
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{}
+	if err := yaml.Unmarshal(blob, config); err != nil {
+		return nil, fmt.Errorf("error decoding %s: %v", path, err)
+	}
+	if len(config.Engines) == 0 {
+		return nil, errors.New("no engines configured")
+	}
+
+	queues := map[string]string{}
+	for _, name := range config.Names() {
+		p := config.Engines[name]
+		if p.TaskQueue == "" {
+			p.TaskQueue = game.EngineQueue(name)
+		}
+		if p.MoveTime == 0 {
+			p.MoveTime = game.DefaultMoveTime
+		}
+		if p.MoveTime < 0 || p.MoveTime > game.MaxMoveTime {
+			return nil, fmt.Errorf("engine %q: move time must be between 0 and %s", name, game.MaxMoveTime)
+		}
+		if _, err := game.ParseProtocol(p.Protocol); err != nil {
+			return nil, fmt.Errorf("engine %q: %v", name, err)
+		}
+		if other, ok := queues[p.TaskQueue]; ok {
+			return nil, fmt.Errorf("engines %q and %q use the same task queue", other, name)
+		}
+		queues[p.TaskQueue] = name
+		config.Engines[name] = p
+	}
+
+	return config, nil
+}
+
+// Names returns the names of the profiles in order.
+func (c *Config) Names() []string {
+	names := make([]string, 0, len(c.Engines))
+	for name := range c.Engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// EngineConfig returns the config of the engine of the profile.
+func (p Profile) EngineConfig() (game.EngineConfig, error) {
+	path, err := game.FindEngine(p.Path)
+	if err != nil {
+		return game.EngineConfig{}, err
+	}
+	protocol, err := game.ParseProtocol(p.Protocol)
+	if err != nil {
+		return game.EngineConfig{}, err
+	}
+
+	return game.EngineConfig{
+		Path:     path,
+		Args:     p.Args,
+		Protocol: protocol,
+		Options:  p.Options,
+	}, nil
+}
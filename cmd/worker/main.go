@@ -4,83 +4,201 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"log"
 	"os"
 
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.temporal.io/api/enums/v1"
 	"go.temporal.io/api/workflowservice/v1"
 	"go.temporal.io/sdk/activity"
-	"go.temporal.io/sdk/client"
 	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
 
 	"github.com/sevein/chesstempo/game"
+	"github.com/sevein/chesstempo/http"
+	"github.com/sevein/chesstempo/logging"
+	"github.com/sevein/chesstempo/temporal"
+	"github.com/sevein/chesstempo/tracing"
 )
 
 const usage = `Usage:
-    chesstempo-worker [-n NAMESPACE] [-q QUEUE] [-a ADDRESS]
+    chesstempo-worker [-n NAMESPACE] [-q QUEUE] [-a ADDRESS] [-e ENGINE] [-p uci|cecp] [-config FILE] [-api-key KEY]
+                      [-health ADDRESS] [-log-format text|json] [-log-level LEVEL]
+                      [-tracing-exporter otlp|stdout] [-tracing-endpoint ADDRESS]
+                      [-tls-cert FILE -tls-key FILE] [-tls-ca FILE] [-tls-server-name NAME]
+
+The engines listed in the configuration file are served in their own task
+queues and cannot be combined with -q, -e or -p.
 `
 
 func main() {
-	log.SetFlags(0)
 	flag.Usage = func() { fmt.Fprintf(os.Stderr, "%s\n", usage) }
 
 	var (
 		namespaceFlag string
 		queueFlag     string
 		addressFlag   string
+		engineFlag    string
+		protocolFlag  string
+		configFlag    string
+		apiKeyFlag    string
+		healthFlag    string
+		logFormatFlag string
+		logLevelFlag  int
+		tracer        = tracing.New()
+		tlsFlags      temporal.TLS
 	)
 
 	flag.StringVar(&namespaceFlag, "n", "default", "temporal namespace")
-	flag.StringVar(&queueFlag, "q", "queue", "temporal task queue")
+	flag.StringVar(&queueFlag, "q", game.EngineQueue(""), "task queue of the engine activities")
 	flag.StringVar(&addressFlag, "a", "127.0.0.1:11111", "temporal frontend address")
+	flag.StringVar(&engineFlag, "e", "", "engine executable, defaults to stockfish")
+	flag.StringVar(&protocolFlag, "p", "uci", "engine protocol (uci or cecp, also xboard)")
+	flag.StringVar(&configFlag, "config", "", "configuration file with the engines")
+	flag.StringVar(&apiKeyFlag, "api-key", os.Getenv("CHESSTEMPO_API_KEY"), "temporal API key")
+	flag.StringVar(&tlsFlags.CertFile, "tls-cert", "", "TLS client certificate")
+	flag.StringVar(&tlsFlags.KeyFile, "tls-key", "", "TLS client key")
+	flag.StringVar(&tlsFlags.CAFile, "tls-ca", "", "TLS certificate authority")
+	flag.StringVar(&tlsFlags.ServerName, "tls-server-name", "", "TLS server name override")
+	flag.StringVar(&healthFlag, "health", "", "listen address of the health and metrics endpoints")
+	flag.StringVar(&logFormatFlag, "log-format", logging.FormatText, "log format (text or json)")
+	flag.IntVar(&logLevelFlag, "log-level", 0, "log verbosity")
+	flag.StringVar(&tracer.Exporter, "tracing-exporter", "", "tracing exporter (otlp or stdout)")
+	flag.StringVar(&tracer.Endpoint, "tracing-endpoint", "", "OTLP endpoint")
+	flag.BoolVar(&tracer.Insecure, "tracing-insecure", false, "disable TLS with the OTLP endpoint")
 	flag.Parse()
 
-	ctx := context.Background()
-
-	bot, err := game.NewBot()
+	level := logging.NewLevel(logLevelFlag)
+	logger, err := logging.New(os.Stderr, logFormatFlag, level)
 	if err != nil {
-		log.Fatalln("Unable to create game bot", err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
-
-	c, err := client.NewClient(client.Options{
-		Namespace: namespaceFlag,
-		HostPort:  addressFlag,
-		Logger:    logger{},
-	})
-	if err != nil {
-		log.Fatalln("Unable to create client", err)
+	logger = logger.WithName("chesstempo-worker")
+
+	// Flags describe a single engine without a name.
+	config := &Config{Engines: map[string]Profile{
+		"": {Path: engineFlag, Protocol: protocolFlag, TaskQueue: queueFlag, MoveTime: game.DefaultMoveTime},
+	}}
+	if configFlag != "" {
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "q" || f.Name == "e" || f.Name == "p" {
+				err = fmt.Errorf("-%s cannot be combined with -config", f.Name)
+			}
+		})
+		if err != nil {
+			logger.Error(err, "Invalid flags")
+			os.Exit(1)
+		}
+		if config, err = readConfig(configFlag); err != nil {
+			logger.Error(err, "Unable to read configuration")
+			os.Exit(1)
+		}
 	}
-	defer c.Close()
-
-	w := worker.New(c, queueFlag, worker.Options{
-		DisableWorkflowWorker: true,
-	})
-	w.RegisterActivityWithOptions(
-		game.NewBotActivity(bot).Execute,
-		activity.RegisterOptions{Name: game.BotActivityName},
-	)
 
-	resp, err := c.WorkflowService().GetSystemInfo(ctx, &workflowservice.GetSystemInfoRequest{})
-	if err != nil {
-		log.Fatal(err)
+	tc := temporal.New()
+	tc.Namespace = namespaceFlag
+	tc.HostPort = addressFlag
+	tc.TLS = tlsFlags
+	tc.Metrics = prometheus.DefaultRegisterer
+	tc.ContextPropagators = []workflow.ContextPropagator{tracing.NewContextPropagator()}
+	if apiKeyFlag != "" {
+		tc.Credentials = temporal.APIKey(apiKeyFlag)
 	}
-	log.Println("Connected to server", resp.ServerVersion)
 
-	err = w.Run(worker.InterruptCh())
-	if err != nil {
-		log.Fatalln("Unable to start worker", err)
+	// The engines are stopped by run, errors are only reported afterwards so
+	// their processes are not left behind.
+	tracer.ServiceName = "chesstempo-worker"
+	if err := run(logger, level, config, tc, tracer, healthFlag); err != nil {
+		logger.Error(err, "Worker failed")
+		os.Exit(1)
 	}
 }
 
-type logger struct{}
+func run(logger logr.Logger, level *logging.Level, config *Config, tc *temporal.Client, tracer *tracing.Tracer, healthAddr string) error {
+	if err := tracer.Open(); err != nil {
+		return fmt.Errorf("unable to set up tracing: %v", err)
+	}
+	defer tracer.Close()
+
+	ctx := context.Background()
+
+	bots := map[string]*game.Bot{}
+	for _, name := range config.Names() {
+		engineConfig, err := config.Engines[name].EngineConfig()
+		if err != nil {
+			return fmt.Errorf("unable to find engine %q: %v", name, err)
+		}
+		bot, err := game.NewBot(engineConfig)
+		if err != nil {
+			return fmt.Errorf("unable to create game bot %q: %v", name, err)
+		}
+		defer bot.Stop()
+		bots[name] = bot
+	}
 
-func (l logger) Debug(msg string, keyvals ...interface{}) {}
+	if err := tc.Create(logger.WithName("temporal")); err != nil {
+		return fmt.Errorf("unable to create client: %v", err)
+	}
+	defer tc.Close()
+	c := tc.Client
 
-func (l logger) Info(msg string, keyvals ...interface{}) {}
+	hostname, _ := os.Hostname()
+	identity := func(queue string) string {
+		return fmt.Sprintf("%d@%s@%s", os.Getpid(), hostname, queue)
+	}
+	var workers []worker.Worker
+	for _, name := range config.Names() {
+		profile := config.Engines[name]
+		w := worker.New(c, profile.TaskQueue, worker.Options{
+			Identity:              identity(profile.TaskQueue),
+			DisableWorkflowWorker: true,
+		})
+		botActivity := game.NewBotActivity(bots[name])
+		botActivity.MoveTime = profile.MoveTime
+		w.RegisterActivityWithOptions(
+			botActivity.Execute,
+			activity.RegisterOptions{Name: game.BotActivityName},
+		)
+		workers = append(workers, w)
+	}
 
-func (l logger) Warn(msg string, keyvals ...interface{}) {
-	log.Println("Temporal client:", msg, keyvals)
-}
+	resp, err := c.WorkflowService().GetSystemInfo(ctx, &workflowservice.GetSystemInfoRequest{})
+	if err != nil {
+		return fmt.Errorf("unable to connect to server: %v", err)
+	}
+	logger.Info("Connected to server", "version", resp.ServerVersion)
+
+	if healthAddr != "" {
+		srv := http.NewDebugServer()
+		srv.Addr = healthAddr
+		srv.LogLevel = level
+		srv.Health.AddReadiness("temporal", tc.CheckConnection)
+		for _, name := range config.Names() {
+			check := "engine"
+			if name != "" {
+				check = "engine-" + name
+			}
+			queue := config.Engines[name].TaskQueue
+			srv.Health.AddReadiness(check, bots[name].Ping)
+			srv.Health.AddReadiness(check+"-worker", func(ctx context.Context) error {
+				return tc.CheckPoller(ctx, queue, enums.TASK_QUEUE_TYPE_ACTIVITY, identity(queue))
+			})
+		}
+		if err := srv.Open(); err != nil {
+			return fmt.Errorf("unable to start health server: %v", err)
+		}
+		defer srv.Close()
+	}
+
+	for i, name := range config.Names() {
+		if err := workers[i].Start(); err != nil {
+			return fmt.Errorf("unable to start worker of engine %q: %v", name, err)
+		}
+		defer workers[i].Stop()
+		logger.Info("Worker started", "engine", name, "queue", config.Engines[name].TaskQueue)
+	}
+	<-worker.InterruptCh()
 
-func (l logger) Error(msg string, keyvals ...interface{}) {
-	log.Println("Temporal client:", msg, keyvals)
+	return nil
 }
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sevein/chesstempo/game"
+	"github.com/sevein/chesstempo/logging"
+	"github.com/sevein/chesstempo/notify"
+	"github.com/sevein/chesstempo/temporal"
+	"github.com/sevein/chesstempo/tracing"
+)
+
+// Config represents the configuration of the chesstempo server.
+//
+// Settings are read in the following order, each source taking precedence
+// over the previous one: defaults, configuration file, environment variables
+// and command-line flags. Environment variables are named after the flags,
+// e.g. CHESSTEMPO_TASK_QUEUE overrides the value of -task-queue.
+type Config struct {
+	Temporal struct {
+		Namespace    string `yaml:"namespace"`
+		TaskQueue    string `yaml:"task-queue"`
+		Embedded     bool   `yaml:"embedded"`
+		Ephemeral    bool   `yaml:"ephemeral"`
+		FrontendPort int    `yaml:"frontend-port"` // Embedded frontend, zero picks a free port.
+		Database     string `yaml:"database"`      // Embedded database, defaults to the user config dir.
+
+		// Connection to an external cluster, used when Embedded is false.
+		HostPort string `yaml:"host-port"`
+		APIKey   string `yaml:"api-key"`
+		TLS      struct {
+			Cert       string `yaml:"cert"`
+			Key        string `yaml:"key"`
+			CA         string `yaml:"ca"`
+			ServerName string `yaml:"server-name"`
+		} `yaml:"tls"`
+	} `yaml:"temporal"`
+
+	HTTP struct {
+		Addr      string `yaml:"addr"`
+		DebugAddr string `yaml:"debug-addr"`
+
+		// ValidateResponses logs the responses of the API that do not
+		// conform to its specification, e.g. in development.
+		ValidateResponses bool `yaml:"validate-responses"`
+	} `yaml:"http"`
+
+	// Engine configures the bot activity worker that runs in the same process.
+	// The machine plays random moves when the engine is not found, disable it
+	// when cmd/worker serves the default engine instead.
+	//
+	// Engine activities are scheduled in their own task queues so engine
+	// workers can be scaled independently. Games request the engines listed
+	// in Engines by name, e.g. strong or weak, served by cmd/worker in the
+	// queue given by game.EngineQueue, or those listed in Queues when the
+	// profile sets its own task queue.
+	Engine struct {
+		Enabled   bool              `yaml:"enabled"`
+		Path      string            `yaml:"path"`     // Defaults to Stockfish in $PATH or well-known locations.
+		Args      []string          `yaml:"args"`     // Arguments of CECP executables.
+		Protocol  string            `yaml:"protocol"` // uci (default) or cecp, e.g. GNU Chess.
+		Options   map[string]string `yaml:"options"`  // Set on start, e.g. Threads or Hash.
+		MoveTime  time.Duration     `yaml:"movetime"` // Search time per move.
+		TaskQueue string            `yaml:"task-queue"`
+		Engines   []string          `yaml:"engines"`
+		Queues    map[string]string `yaml:"queues"`
+	} `yaml:"engine"`
+
+	// Log sets the format and the verbosity of the logger. The verbosity can
+	// be changed at runtime via the debug server.
+	Log struct {
+		Format string `yaml:"format"` // text or json.
+		Level  int    `yaml:"level"`
+	} `yaml:"log"`
+
+	// Tracing exports spans via OTLP or to stdout, disabled by default.
+	Tracing struct {
+		Exporter string `yaml:"exporter"`
+		Endpoint string `yaml:"endpoint"`
+		Insecure bool   `yaml:"insecure"`
+	} `yaml:"tracing"`
+
+	// Notify configures the delivery of the notifications of correspondence
+	// games. Users can only choose webhooks and email addresses in the hosts
+	// and domains listed here, e.g. "*.example.com", none by default.
+	Notify struct {
+		SMTPAddr     string   `yaml:"smtp-addr"`
+		SMTPFrom     string   `yaml:"smtp-from"`
+		WebhookHosts []string `yaml:"webhook-hosts"`
+		EmailDomains []string `yaml:"email-domains"`
+	} `yaml:"notify"`
+
+	// Lichess maps the levels of the AI in the Lichess API, 1 to 8, to the
+	// engines requested by name, e.g. {1: weak, 8: strong}. Levels without
+	// an engine play the closest lower level, or the default engine.
+	Lichess struct {
+		Levels map[int]string `yaml:"levels"`
+	} `yaml:"lichess"`
+
+	// Bots limits the remote bots and keeps their registrations in File, in
+	// the user config dir unless set. They are not kept in ephemeral mode.
+	Bots struct {
+		File string `yaml:"file"`
+		Max  int    `yaml:"max"`
+	} `yaml:"bots"`
+
+	// Shutdown bounds the time given to in-flight requests and activities to
+	// complete when the server stops.
+	Shutdown struct {
+		HTTPTimeout   time.Duration `yaml:"http-timeout"`
+		WorkerTimeout time.Duration `yaml:"worker-timeout"`
+	} `yaml:"shutdown"`
+
+	Games struct {
+		Idle struct {
+			Live           game.IdleTimeout `yaml:"live"`
+			Correspondence game.IdleTimeout `yaml:"correspondence"`
+		} `yaml:"idle"`
+	} `yaml:"games"`
+}
+
+// DefaultConfig returns a new instance of Config with defaults set.
+func DefaultConfig() Config {
+	var config Config
+	config.Temporal.Namespace = "default"
+	config.Temporal.TaskQueue = "queue"
+	config.Temporal.Embedded = true
+	config.Temporal.FrontendPort = 11111
+	config.HTTP.Addr = ":9999"
+	config.HTTP.DebugAddr = ":6060"
+	config.Engine.Enabled = true
+	config.Engine.TaskQueue = game.EngineQueue("")
+	config.Engine.MoveTime = game.DefaultMoveTime
+	config.Log.Format = logging.FormatText
+	config.Log.Level = 1
+	config.Notify.SMTPAddr = "127.0.0.1:1025"
+	config.Notify.SMTPFrom = "chesstempo@localhost"
+	config.Bots.Max = game.DefaultMaxRemoteBots
+	config.Shutdown.HTTPTimeout = time.Second * 10
+	config.Shutdown.WorkerTimeout = time.Second * 10
+	config.Games.Idle.Live = game.DefaultIdlePolicy.Live
+	config.Games.Idle.Correspondence = game.DefaultIdlePolicy.Correspondence
+	return config
+}
+
+// ReadConfigFile unmarshals the YAML file at path into config.
+func ReadConfigFile(config *Config, path string) error {
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := yaml.Unmarshal(blob, config); err != nil {
+		return fmt.Errorf("error decoding %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// TemporalTLS returns the TLS options of the connection with the cluster.
+func (c Config) TemporalTLS() temporal.TLS {
+	return temporal.TLS{
+		CertFile:   c.Temporal.TLS.Cert,
+		KeyFile:    c.Temporal.TLS.Key,
+		CAFile:     c.Temporal.TLS.CA,
+		ServerName: c.Temporal.TLS.ServerName,
+	}
+}
+
+// NotifyAllowlist returns the recipients of notifications accepted from users.
+func (c Config) NotifyAllowlist() notify.Allowlist {
+	return notify.Allowlist{
+		WebhookHosts: c.Notify.WebhookHosts,
+		EmailDomains: c.Notify.EmailDomains,
+	}
+}
+
+// IdlePolicy returns the idle policy applied to new games.
+func (c Config) IdlePolicy() game.IdlePolicy {
+	return game.IdlePolicy{
+		Live:           c.Games.Idle.Live,
+		Correspondence: c.Games.Idle.Correspondence,
+	}
+}
+
+// BotsFile returns the file where the registrations of the remote bots are
+// kept, empty in ephemeral mode.
+func (c Config) BotsFile() (string, error) {
+	if c.Temporal.Ephemeral {
+		return "", nil
+	}
+	if c.Bots.File != "" {
+		return c.Bots.File, nil
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "chesstempo-bots.json"), nil
+}
+
+// EngineQueues returns the task queues of the engines requested by name.
+func (c Config) EngineQueues() map[string]string {
+	queues := make(map[string]string, len(c.Engine.Engines)+len(c.Engine.Queues))
+	for _, name := range c.Engine.Engines {
+		queues[name] = game.EngineQueue(name)
+	}
+	for name, queue := range c.Engine.Queues {
+		queues[name] = queue
+	}
+	return queues
+}
+
+func (c Config) Validate() error {
+	switch {
+	case c.Temporal.Namespace == "":
+		return errors.New("namespace is undefined")
+	case c.Temporal.TaskQueue == "":
+		return errors.New("task queue is undefined")
+	case c.Engine.TaskQueue == "":
+		return errors.New("engine task queue is undefined")
+	case c.Temporal.Ephemeral && !c.Temporal.Embedded:
+		return errors.New("ephemeral mode requires the embedded server")
+	case c.Temporal.FrontendPort < 0 || c.Temporal.FrontendPort > 65535:
+		return fmt.Errorf("frontend port %d is out of range", c.Temporal.FrontendPort)
+	case c.Temporal.Embedded && c.Temporal.HostPort != "":
+		return errors.New("host-port requires an external server, disable embedded mode")
+	case c.HTTP.Addr == "":
+		return errors.New("HTTP address is undefined")
+	case c.HTTP.Addr == c.HTTP.DebugAddr:
+		return errors.New("HTTP and debug addresses must be different")
+	case c.Log.Level < 0 || c.Log.Level > 127:
+		return fmt.Errorf("log level %d is out of range", c.Log.Level)
+	case c.Shutdown.HTTPTimeout < 0 || c.Shutdown.WorkerTimeout < 0:
+		return errors.New("shutdown timeouts cannot be negative")
+	case c.Bots.Max < 1:
+		return errors.New("bots max must be positive")
+	}
+
+	if _, err := game.ParseProtocol(c.Engine.Protocol); err != nil {
+		return err
+	}
+	if c.Engine.MoveTime <= 0 || c.Engine.MoveTime > game.MaxMoveTime {
+		return fmt.Errorf("engine move time must be between 0 and %s", game.MaxMoveTime)
+	}
+
+	for _, pattern := range append(append([]string{}, c.Notify.WebhookHosts...), c.Notify.EmailDomains...) {
+		if name := strings.TrimPrefix(pattern, "*."); name == "" || strings.Contains(name, "*") {
+			return fmt.Errorf("notification host %q is invalid", pattern)
+		}
+	}
+
+	for name, queue := range c.Engine.Queues {
+		if name == "" || queue == "" {
+			return fmt.Errorf("engine %q has no task queue", name)
+		}
+	}
+	for level, name := range c.Lichess.Levels {
+		if level < 1 || level > 8 || name == "" {
+			return fmt.Errorf("lichess level %d must be between 1 and 8 and name an engine", level)
+		}
+	}
+	for _, name := range c.Engine.Engines {
+		if name == "" {
+			return errors.New("engine name is empty")
+		}
+		if _, ok := c.Engine.Queues[name]; ok {
+			return fmt.Errorf("engine %q is listed in engines and queues", name)
+		}
+	}
+
+	if err := logging.Validate(c.Log.Format); err != nil {
+		return err
+	}
+
+	if err := tracing.Validate(c.Tracing.Exporter); err != nil {
+		return err
+	}
+
+	if err := c.TemporalTLS().Validate(); err != nil {
+		return err
+	}
+
+	for mode, idle := range map[string]game.IdleTimeout{
+		"live":           c.Games.Idle.Live,
+		"correspondence": c.Games.Idle.Correspondence,
+	} {
+		if idle.Warn < 0 || idle.Abandon < 0 {
+			return fmt.Errorf("idle timeouts of %s games cannot be negative", mode)
+		}
+		if idle.Warn > 0 && idle.Abandon > 0 && idle.Warn >= idle.Abandon {
+			return fmt.Errorf("idle warning of %s games must come before abandonment", mode)
+		}
+	}
+
+	return nil
+}
+
+const envPrefix = "CHESSTEMPO_"
+
+// ParseFlags parses the command line arguments & loads the configuration.
+func (m *Main) ParseFlags(args []string) error {
+	fs := flag.NewFlagSet("chesstempo", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv(envPrefix+"CONFIG"), "config file path")
+	defaults := DefaultConfig()
+	bindFlags(fs, &defaults)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	config := DefaultConfig()
+	if *configPath != "" {
+		if err := ReadConfigFile(&config, *configPath); err != nil {
+			return err
+		}
+	}
+
+	// Environment variables and flags are applied on top of the file using a
+	// second set of flags bound to the final configuration.
+	overrides := flag.NewFlagSet("", flag.ContinueOnError)
+	bindFlags(overrides, &config)
+
+	var err error
+	overrides.VisitAll(func(f *flag.Flag) {
+		name := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value, ok := os.LookupEnv(name); ok && err == nil {
+			if err = overrides.Set(f.Name, value); err != nil {
+				err = fmt.Errorf("invalid value of %s: %v", name, err)
+			}
+		}
+	})
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "config" && err == nil {
+			err = overrides.Set(f.Name, f.Value.String())
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	m.Config = config
+
+	return nil
+}
+
+func bindFlags(fs *flag.FlagSet, config *Config) {
+	fs.StringVar(&config.Temporal.Namespace, "namespace", config.Temporal.Namespace, "Temporal namespace")
+	fs.StringVar(&config.Temporal.TaskQueue, "task-queue", config.Temporal.TaskQueue, "Temporal task queue")
+	fs.BoolVar(&config.Temporal.Embedded, "embedded", config.Temporal.Embedded, "run an embedded Temporal server")
+	fs.BoolVar(&config.Temporal.Ephemeral, "ephemeral", config.Temporal.Ephemeral, "disable persistence of the embedded server")
+	fs.IntVar(&config.Temporal.FrontendPort, "frontend-port", config.Temporal.FrontendPort, "frontend port of the embedded server")
+	fs.StringVar(&config.Temporal.Database, "database", config.Temporal.Database, "database file of the embedded server")
+	fs.StringVar(&config.Temporal.HostPort, "host-port", config.Temporal.HostPort, "frontend address of the external server")
+	fs.StringVar(&config.Temporal.APIKey, "api-key", config.Temporal.APIKey, "API key sent to the external server")
+	fs.StringVar(&config.Temporal.TLS.Cert, "tls-cert", config.Temporal.TLS.Cert, "TLS client certificate")
+	fs.StringVar(&config.Temporal.TLS.Key, "tls-key", config.Temporal.TLS.Key, "TLS client key")
+	fs.StringVar(&config.Temporal.TLS.CA, "tls-ca", config.Temporal.TLS.CA, "TLS certificate authority")
+	fs.StringVar(&config.Temporal.TLS.ServerName, "tls-server-name", config.Temporal.TLS.ServerName, "TLS server name override")
+	fs.StringVar(&config.HTTP.Addr, "addr", config.HTTP.Addr, "HTTP listen address")
+	fs.StringVar(&config.HTTP.DebugAddr, "debug-addr", config.HTTP.DebugAddr, "debug server listen address")
+	fs.BoolVar(&config.HTTP.ValidateResponses, "validate-responses", config.HTTP.ValidateResponses, "log API responses that do not conform to the specification")
+	fs.BoolVar(&config.Engine.Enabled, "engine", config.Engine.Enabled, "run the bot activity worker")
+	fs.StringVar(&config.Engine.Path, "engine-path", config.Engine.Path, "engine executable")
+	fs.StringVar(&config.Engine.Protocol, "engine-protocol", config.Engine.Protocol, "engine protocol (uci or cecp)")
+	fs.DurationVar(&config.Engine.MoveTime, "engine-movetime", config.Engine.MoveTime, "engine search time per move")
+	fs.StringVar(&config.Engine.TaskQueue, "engine-task-queue", config.Engine.TaskQueue, "task queue of the default engine")
+	fs.StringVar(&config.Bots.File, "bots-file", config.Bots.File, "file where the remote bots are kept")
+	fs.IntVar(&config.Bots.Max, "bots-max", config.Bots.Max, "number of remote bots that can be registered")
+	fs.DurationVar(&config.Shutdown.HTTPTimeout, "shutdown-http-timeout", config.Shutdown.HTTPTimeout, "time given to in-flight requests on shutdown")
+	fs.DurationVar(&config.Shutdown.WorkerTimeout, "shutdown-worker-timeout", config.Shutdown.WorkerTimeout, "time given to in-flight activities on shutdown")
+	fs.StringVar(&config.Log.Format, "log-format", config.Log.Format, "log format (text or json)")
+	fs.IntVar(&config.Log.Level, "log-level", config.Log.Level, "log verbosity")
+	fs.StringVar(&config.Tracing.Exporter, "tracing-exporter", config.Tracing.Exporter, "tracing exporter (otlp or stdout)")
+	fs.StringVar(&config.Tracing.Endpoint, "tracing-endpoint", config.Tracing.Endpoint, "OTLP endpoint")
+	fs.BoolVar(&config.Tracing.Insecure, "tracing-insecure", config.Tracing.Insecure, "disable TLS with the OTLP endpoint")
+	fs.StringVar(&config.Notify.SMTPAddr, "smtp-addr", config.Notify.SMTPAddr, "SMTP server address")
+	fs.StringVar(&config.Notify.SMTPFrom, "smtp-from", config.Notify.SMTPFrom, "sender of email notifications")
+}
@@ -0,0 +1,75 @@
+package main_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	main "github.com/sevein/chesstempo"
+)
+
+func TestParseFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chesstempo.yaml")
+	if err := os.WriteFile(path, []byte(`
+temporal:
+  namespace: chess
+  task-queue: from-file
+  embedded: false
+http:
+  addr: ":8000"
+engine:
+  engines: [strong]
+  queues: {gnuchess: engine-gnu}
+lichess:
+  levels: {8: strong}
+games:
+  idle:
+    live:
+      warn: 1m
+      abandon: 2m
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("CHESSTEMPO_TASK_QUEUE", "from-env")
+	t.Setenv("CHESSTEMPO_ADDR", ":8001")
+
+	m := main.NewMain()
+	if err := m.ParseFlags([]string{"-config", path, "-addr", ":8002"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := m.Config.Temporal.Namespace, "chess"; got != want {
+		t.Errorf("namespace: got %q, want %q", got, want)
+	}
+	if got, want := m.Config.Temporal.Embedded, false; got != want {
+		t.Errorf("embedded: got %v, want %v", got, want)
+	}
+	if got, want := m.Config.Temporal.TaskQueue, "from-env"; got != want {
+		t.Errorf("task queue: got %q, want %q", got, want)
+	}
+	if got, want := m.Config.HTTP.Addr, ":8002"; got != want {
+		t.Errorf("addr: got %q, want %q", got, want)
+	}
+	if got, want := m.Config.HTTP.DebugAddr, ":6060"; got != want {
+		t.Errorf("debug addr: got %q, want %q", got, want)
+	}
+	if got, want := m.Config.Games.Idle.Live.Abandon, 2*time.Minute; got != want {
+		t.Errorf("live abandon: got %v, want %v", got, want)
+	}
+	if got, want := m.Config.EngineQueues(), map[string]string{"strong": "engine-strong", "gnuchess": "engine-gnu"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("engine queues: got %v, want %v", got, want)
+	}
+	if got, want := m.Config.Lichess.Levels[8], "strong"; got != want {
+		t.Errorf("lichess level 8: got %q, want %q", got, want)
+	}
+}
+
+func TestParseFlagsInvalid(t *testing.T) {
+	m := main.NewMain()
+	if err := m.ParseFlags([]string{"-embedded=false", "-ephemeral"}); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -2,43 +2,85 @@ package game
 
 import (
 	"context"
-	"log"
+	"errors"
+	"os/exec"
+	"sync"
 	"time"
 
 	"github.com/notnil/chess"
-	"github.com/notnil/chess/uci"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+
+	"github.com/sevein/chesstempo/tracing"
 )
 
-type Bot struct {
-	ng *uci.Engine
+// enginePaths are searched when Stockfish is not found in $PATH, e.g. Debian
+// installs it in /usr/games.
+var enginePaths = []string{
+	"/usr/games/stockfish",
+	"/usr/local/bin/stockfish",
+	"/opt/homebrew/bin/stockfish",
+}
+
+var ErrEngineNotFound = errors.New("chess engine not found")
+
+// FindEngine returns the path of the engine executable. An empty path looks
+// for Stockfish in $PATH and in well-known locations.
+func FindEngine(path string) (string, error) {
+	if path != "" {
+		return exec.LookPath(path)
+	}
+
+	if path, err := exec.LookPath("stockfish"); err == nil {
+		return path, nil
+	}
+	for _, path := range enginePaths {
+		if path, err := exec.LookPath(path); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", ErrEngineNotFound
 }
 
-func NewBot() (*Bot, error) {
-	bot := Bot{}
+type Bot struct {
+	ng Engine
+	mu sync.Mutex // The engine runs one search at a time.
+}
 
-	ng, err := uci.New("stockfish")
+// NewBot starts the engine described by the config.
+func NewBot(config EngineConfig) (*Bot, error) {
+	ng, err := NewEngine(config)
 	if err != nil {
 		return nil, err
 	}
-	bot.ng = ng
 
-	return &bot, nil
+	return &Bot{ng: ng}, nil
 }
 
-func (b *Bot) Play(fen string, dur time.Duration) (*chess.Move, error) {
+// Play searches the best move of the position for up to dur, see
+// Engine.BestMove.
+func (b *Bot) Play(ctx context.Context, fen string, dur time.Duration, info func(SearchInfo)) (*chess.Move, error) {
 	game, err := createGame(fen)
 	if err != nil {
 		return nil, err
 	}
 
-	cmdPos := uci.CmdPosition{Position: game.Position()}
-	cmdGo := uci.CmdGo{MoveTime: dur}
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
-	if err := b.ng.Run(uci.CmdUCINewGame, cmdPos, cmdGo); err != nil {
-		return nil, err
-	}
+	return b.ng.BestMove(ctx, game.Position(), dur, info)
+}
 
-	return b.ng.SearchResults().BestMove, nil
+// Ping checks that the engine process is running. It does not wait for the
+// engine, which may be in the middle of a search.
+func (b *Bot) Ping(ctx context.Context) error {
+	if !b.ng.Running() {
+		return errEngineExited
+	}
+	return nil
 }
 
 func (b *Bot) Stop() {
@@ -47,19 +89,86 @@ func (b *Bot) Stop() {
 
 const BotActivityName = "play"
 
+// EngineQueue returns the task queue of the engine with the given name, where
+// its workers poll the bot activity. The default engine, with an empty name or
+// named default, uses the queue engine.
+func EngineQueue(name string) string {
+	if name == "" || name == "default" {
+		return "engine"
+	}
+	return "engine-" + name
+}
+
+// DefaultMoveTime is the time the engine searches each move.
+const DefaultMoveTime = time.Millisecond * 250
+
+// MaxMoveTime leaves time for the move to be delivered before the bot activity
+// times out after five seconds.
+const MaxMoveTime = time.Second * 4
+
 type BotActivity struct {
 	bot *Bot
+
+	MoveTime time.Duration
 }
 
 func NewBotActivity(bot *Bot) *BotActivity {
-	return &BotActivity{bot}
+	return &BotActivity{
+		bot:      bot,
+		MoveTime: DefaultMoveTime,
+	}
 }
 
+// engineUnavailableErrorType is the type of the error returned by
+// UnavailableBotActivity.
+const engineUnavailableErrorType = "EngineUnavailable"
+
+// UnavailableBotActivity is registered instead of BotActivity when the engine
+// did not start, so the machine plays random moves right away rather than
+// waiting for an engine.
+func UnavailableBotActivity(ctx context.Context, fen string) (string, error) {
+	return "", temporal.NewNonRetryableApplicationError("engine is not available", engineUnavailableErrorType, nil)
+}
+
+func isEngineUnavailable(err error) bool {
+	var appErr *temporal.ApplicationError
+	return errors.As(err, &appErr) && appErr.Type() == engineUnavailableErrorType
+}
+
+// Execute searches the move of the machine. The progress of the search is
+// sent with the heartbeats and the search is stopped when the activity is
+// canceled, e.g. the user resigned.
 func (b *BotActivity) Execute(ctx context.Context, fen string) (string, error) {
-	move, err := b.bot.Play(fen, time.Millisecond*250)
+	_, span := tracing.Start(ctx, "BotActivity.Execute", attribute.String("game.fen", fen))
+	defer span.End()
+
+	var (
+		mu   sync.Mutex
+		last SearchInfo
+	)
+	defer heartbeat(ctx, func() interface{} {
+		mu.Lock()
+		defer mu.Unlock()
+		return last
+	})()
+
+	start := time.Now()
+	move, err := b.bot.Play(ctx, fen, b.MoveTime, func(info SearchInfo) {
+		mu.Lock()
+		last = info
+		mu.Unlock()
+	})
+	if err != nil && ctx.Err() != nil {
+		activity.GetLogger(ctx).Info("Search canceled", "fen", fen)
+		return "", ctx.Err()
+	}
 	if err != nil {
+		engineFailures.Inc()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return "", err
 	}
+	engineThinkTime.Observe(time.Since(start).Seconds())
 
 	game, err := createGame(fen)
 	if err != nil {
@@ -68,11 +177,41 @@ func (b *BotActivity) Execute(ctx context.Context, fen string) (string, error) {
 
 	encoded := ChessNotation.Encode(game.Position(), move)
 
-	log.Println("Generated move:", encoded)
+	span.SetAttributes(attribute.Int("engine.depth", last.Depth), attribute.Int("engine.score", last.Score))
+	activity.GetLogger(ctx).Info("Generated move", "move", encoded, "fen", fen, "depth", last.Depth, "score", last.Score)
 
 	return encoded, nil
 }
 
+// heartbeatInterval is shorter than the heartbeat timeout of the bot activity
+// so it learns soon that it was canceled.
+const heartbeatInterval = time.Second / 2
+
+// heartbeat records the heartbeats of the activity with the details returned
+// by details, if not nil, until the returned function is called.
+func heartbeat(ctx context.Context, details func() interface{}) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			if details != nil {
+				activity.RecordHeartbeat(ctx, details())
+			} else {
+				activity.RecordHeartbeat(ctx)
+			}
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
 func createGame(fen string) (*chess.Game, error) {
 	opts := []func(*chess.Game){
 		chess.UseNotation(ChessNotation),
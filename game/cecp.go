@@ -0,0 +1,290 @@
+package game
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/notnil/chess"
+)
+
+// Engines have two seconds to send their features unless they ask for more
+// time with done=0, see https://www.gnu.org/software/xboard/engine-intf.html.
+var cecpFeatureTimeout = time.Second * 2
+
+// cecpEngine speaks the Chess Engine Communication Protocol, version 2. The
+// engine is given positions with setboard, so it must support that feature.
+type cecpEngine struct {
+	*process
+	features map[string]string
+	options  map[string]bool // Declared with the option feature.
+	pings    int
+}
+
+func newCECPEngine(config EngineConfig) (*cecpEngine, error) {
+	p, err := startProcess(config.Path, config.Args)
+	if err != nil {
+		return nil, err
+	}
+	e := &cecpEngine{
+		process:  p,
+		features: map[string]string{},
+		options:  map[string]bool{},
+	}
+
+	if err := e.init(config.Options); err != nil {
+		e.Close()
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (e *cecpEngine) init(options map[string]string) error {
+	if err := e.send("xboard", "protover 2"); err != nil {
+		return err
+	}
+
+	timeout := time.NewTimer(cecpFeatureTimeout)
+	defer timeout.Stop()
+
+features:
+	for {
+		select {
+		case line, ok := <-e.lines:
+			if !ok {
+				return errEngineExited
+			}
+			if !strings.HasPrefix(line, "feature ") {
+				continue
+			}
+			for _, feature := range parseFeatures(strings.TrimPrefix(line, "feature ")) {
+				key, value := feature[0], feature[1]
+				if key == "option" {
+					name := value
+					if i := strings.Index(name, " -"); i >= 0 {
+						name = name[:i]
+					}
+					e.options[strings.ToLower(strings.TrimSpace(name))] = true
+				} else {
+					e.features[key] = value
+				}
+				if err := e.send("accepted " + key); err != nil {
+					return err
+				}
+			}
+			switch e.features["done"] {
+			case "0":
+				timeout.Reset(engineTimeout)
+			case "1":
+				break features
+			}
+		case <-timeout.C:
+			break features // Engines of version 1 send no features.
+		}
+	}
+
+	if e.features["setboard"] != "1" {
+		return errors.New("engine does not support setboard")
+	}
+
+	for _, name := range sortedKeys(options) {
+		if !e.options[strings.ToLower(name)] {
+			return fmt.Errorf("engine has no option %q", name)
+		}
+		if err := e.send(fmt.Sprintf("option %s=%s", name, options[name])); err != nil {
+			return err
+		}
+	}
+
+	// No pondering, thinking output reports the progress of the searches.
+	return e.send("easy", "post")
+}
+
+func (e *cecpEngine) BestMove(ctx context.Context, pos *chess.Position, dur time.Duration, info func(SearchInfo)) (*chess.Move, error) {
+	if err := e.sync(); err != nil {
+		return nil, err
+	}
+
+	secs := int(math.Ceil(dur.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	if err := e.send("new", "force", "setboard "+pos.String(), fmt.Sprintf("st %d", secs), "go"); err != nil {
+		return nil, err
+	}
+
+	// The time per move is given in seconds, so the engine is asked to move
+	// now once dur has elapsed.
+	moveNow := time.NewTimer(dur)
+	defer moveNow.Stop()
+	timeout := time.NewTimer(dur + engineTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case line, ok := <-e.lines:
+			if !ok {
+				return nil, errEngineExited
+			}
+			if move, ok := cecpMove(line); ok {
+				if err := e.send("force"); err != nil {
+					return nil, err
+				}
+				uci, err := DecodeMove(pos, move, NotationAuto)
+				if err != nil {
+					return nil, fmt.Errorf("engine played %q: %v", move, err)
+				}
+				return chess.UCINotation{}.Decode(pos, uci)
+			}
+			if err := cecpError(line); err != nil {
+				return nil, err
+			}
+			if si, ok := parseCECPThinking(line); ok && info != nil {
+				info(si)
+			}
+		case <-ctx.Done():
+			// The engine stops thinking in force mode, a move sent
+			// meanwhile is discarded by the next search.
+			if err := e.send("force"); err != nil {
+				return nil, err
+			}
+			return nil, ctx.Err()
+		case <-moveNow.C:
+			if err := e.send("?"); err != nil {
+				return nil, err
+			}
+		case <-timeout.C:
+			return nil, errors.New("engine did not move")
+		}
+	}
+}
+
+// Ping checks that the engine replies to ping, or that it is still running
+// if it does not support the feature.
+func (e *cecpEngine) Ping() error {
+	if e.features["ping"] != "1" {
+		if !e.Running() {
+			return errEngineExited
+		}
+		return nil
+	}
+	return e.sync()
+}
+
+// sync waits until the engine has processed the previous commands, which
+// discards their output, e.g. a move sent after the search timed out.
+func (e *cecpEngine) sync() error {
+	if e.features["ping"] != "1" {
+		for {
+			select {
+			case _, ok := <-e.lines:
+				if !ok {
+					return errEngineExited
+				}
+			default:
+				return nil
+			}
+		}
+	}
+
+	e.pings++
+	if err := e.send(fmt.Sprintf("ping %d", e.pings)); err != nil {
+		return err
+	}
+	pong := fmt.Sprintf("pong %d", e.pings)
+
+	_, err := e.waitFor(func(line string) bool {
+		return strings.TrimSpace(line) == pong
+	}, engineTimeout)
+	return err
+}
+
+func (e *cecpEngine) Close() error {
+	return e.close("quit")
+}
+
+// cecpMove returns the move of a line like "move e2e4" or, as written by
+// older engines, "My move is: e2e4".
+func cecpMove(line string) (string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) >= 2 && fields[0] == "move" {
+		return fields[1], true
+	}
+	if strings.HasPrefix(line, "My move is") {
+		if i := strings.Index(line, ":"); i >= 0 {
+			if fields := strings.Fields(line[i+1:]); len(fields) > 0 {
+				return fields[0], true
+			}
+		}
+	}
+	return "", false
+}
+
+// cecpError returns the error reported by a line, if any. Engines resign or
+// claim the result instead of moving.
+func cecpError(line string) error {
+	switch {
+	case strings.HasPrefix(line, "Illegal move"), strings.HasPrefix(line, "Error"):
+		return fmt.Errorf("engine error: %s", line)
+	case line == "resign", strings.HasPrefix(line, "1-0"), strings.HasPrefix(line, "0-1"), strings.HasPrefix(line, "1/2-1/2"):
+		return fmt.Errorf("engine did not move: %s", line)
+	}
+	return nil
+}
+
+// parseCECPThinking parses the thinking output of the engine, lines like
+// "9 156 1084 48000 Nf3 Nc6 Nc3 Nf6" with the ply, the score in centipawns,
+// the time and the nodes searched followed by the principal variation.
+func parseCECPThinking(line string) (SearchInfo, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return SearchInfo{}, false
+	}
+	depth, err := strconv.Atoi(strings.TrimRight(fields[0], ".&"))
+	if err != nil {
+		return SearchInfo{}, false
+	}
+	score, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return SearchInfo{}, false
+	}
+	return SearchInfo{Depth: depth, Score: score}, true
+}
+
+// parseFeatures parses the arguments of the feature command, e.g.
+// ping=1 myname="GNU Chess 6", in order. Features like option may appear
+// more than once.
+func parseFeatures(s string) [][2]string {
+	var ret [][2]string
+	for {
+		s = strings.TrimSpace(s)
+		i := strings.Index(s, "=")
+		if i <= 0 {
+			return ret
+		}
+		key, rest := s[:i], s[i+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			rest = rest[1:]
+			end := strings.Index(rest, `"`)
+			if end < 0 {
+				value, s = rest, ""
+			} else {
+				value, s = rest[:end], rest[end+1:]
+			}
+		} else {
+			end := strings.IndexAny(rest, " \t")
+			if end < 0 {
+				end = len(rest)
+			}
+			value, s = rest[:end], rest[end:]
+		}
+		ret = append(ret, [2]string{key, value})
+	}
+}
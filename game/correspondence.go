@@ -0,0 +1,91 @@
+package game
+
+import (
+	"errors"
+	"time"
+
+	"go.temporal.io/sdk/workflow"
+)
+
+// CorrespondenceSettings holds the settings of correspondence games. The
+// machine moves right away so deadlines and vacation only apply to the user.
+type CorrespondenceSettings struct {
+	DaysPerMove  int       `json:"daysPerMove"`  // Days the user has to make each move.
+	VacationDays int       `json:"vacationDays"` // Days the user can add to its deadlines.
+	Notify       Recipient `json:"notify"`       // Where notifications are delivered.
+}
+
+// DefaultCorrespondenceSettings is used when a correspondence game is started
+// without settings.
+var DefaultCorrespondenceSettings = CorrespondenceSettings{
+	DaysPerMove:  3,
+	VacationDays: 7,
+}
+
+func (c *CorrespondenceSettings) Validate() error {
+	if c.DaysPerMove < 1 {
+		return errors.New("days per move must be at least one")
+	}
+	if c.VacationDays < 0 {
+		return errors.New("vacation days cannot be negative")
+	}
+	return nil
+}
+
+// moveDeadline enforces the days-per-move deadline of the user's turn using
+// durable timers. A reminder is sent before the deadline expires.
+type moveDeadline struct {
+	ctx      workflow.Context
+	selector workflow.Selector
+	cancel   workflow.CancelFunc
+	remind   func(deadline time.Time)
+	at       time.Time
+	expired  bool
+}
+
+func newMoveDeadline(ctx workflow.Context, selector workflow.Selector, days int, remind func(time.Time)) *moveDeadline {
+	d := &moveDeadline{ctx: ctx, selector: selector, remind: remind}
+	d.set(workflow.Now(ctx).Add(day * time.Duration(days)))
+	return d
+}
+
+const day = time.Hour * 24
+
+// set moves the deadline, replacing the timers of the previous one.
+func (d *moveDeadline) set(at time.Time) {
+	d.stop()
+
+	ctx, cancel := workflow.WithCancel(d.ctx)
+	d.cancel = cancel
+	d.at = at
+
+	left := at.Sub(workflow.Now(ctx))
+	d.selector.AddFuture(workflow.NewTimer(ctx, left), func(f workflow.Future) {
+		if f.Get(ctx, nil) == nil {
+			d.expired = true
+		}
+	})
+
+	// Remind the user a day before the deadline, or halfway through when
+	// there is less than a day left.
+	lead := day
+	if left <= lead {
+		lead = left / 2
+	}
+	d.selector.AddFuture(workflow.NewTimer(ctx, left-lead), func(f workflow.Future) {
+		if f.Get(ctx, nil) == nil {
+			d.remind(at)
+		}
+	})
+}
+
+// extend adds days to the deadline.
+func (d *moveDeadline) extend(days int) {
+	d.set(d.at.Add(day * time.Duration(days)))
+}
+
+func (d *moveDeadline) stop() {
+	if d.cancel != nil {
+		d.cancel()
+	}
+}
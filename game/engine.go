@@ -0,0 +1,389 @@
+package game
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/notnil/chess"
+	"github.com/notnil/chess/uci"
+)
+
+// Protocol is the protocol spoken by an engine.
+type Protocol string
+
+const (
+	ProtocolUCI  Protocol = "uci"
+	ProtocolCECP Protocol = "cecp" // Spoken by XBoard and WinBoard.
+)
+
+// ParseProtocol returns the protocol with the given name, UCI when empty.
+// "xboard" and "winboard" are accepted as CECP.
+func ParseProtocol(name string) (Protocol, error) {
+	switch strings.ToLower(name) {
+	case "", "uci":
+		return ProtocolUCI, nil
+	case "cecp", "xboard", "winboard":
+		return ProtocolCECP, nil
+	}
+	return "", fmt.Errorf("unknown engine protocol %q", name)
+}
+
+// EngineConfig describes how to start an engine.
+type EngineConfig struct {
+	Path     string
+	Args     []string // Only supported by CECP engines.
+	Protocol Protocol
+
+	// Options are set when the engine starts, e.g. Threads, Hash or
+	// SyzygyPath. CECP engines must declare them with the option feature.
+	Options map[string]string
+}
+
+// SearchInfo is the progress of a search reported by the engine.
+type SearchInfo struct {
+	Depth int `json:"depth"`
+	Score int `json:"score"`          // Centipawns, from the side to move.
+	Mate  int `json:"mate,omitempty"` // Moves to mate, negative when mated.
+}
+
+// Engine is a chess engine running in a separate process. Engines run one
+// command at a time.
+type Engine interface {
+	// BestMove searches the position for up to dur, reporting the progress
+	// of the search to info if not nil. The search is stopped when ctx is
+	// done.
+	BestMove(ctx context.Context, pos *chess.Position, dur time.Duration, info func(SearchInfo)) (*chess.Move, error)
+
+	// Ping checks that the engine responds.
+	Ping() error
+
+	// Running reports whether the engine process has not exited, without
+	// waiting for the engine.
+	Running() bool
+
+	Close() error
+}
+
+// NewEngine starts the engine executable.
+func NewEngine(config EngineConfig) (Engine, error) {
+	switch config.Protocol {
+	case ProtocolUCI, "":
+		return newUCIEngine(config)
+	case ProtocolCECP:
+		return newCECPEngine(config)
+	}
+	return nil, fmt.Errorf("unknown engine protocol %q", config.Protocol)
+}
+
+// engineTimeout bounds the replies of the engines other than moves.
+var engineTimeout = time.Second * 10
+
+var errEngineExited = errors.New("engine exited")
+
+// process is an engine process that reads commands from its standard input
+// and replies with lines in its standard output.
+type process struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	lines  chan string
+	exited chan struct{}
+}
+
+func startProcess(path string, args []string) (*process, error) {
+	cmd := exec.Command(path, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	p := &process{
+		cmd:    cmd,
+		stdin:  stdin,
+		lines:  make(chan string, 64),
+		exited: make(chan struct{}),
+	}
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			p.lines <- scanner.Text()
+		}
+		close(p.lines)
+		close(p.exited)
+	}()
+
+	return p, nil
+}
+
+func (p *process) send(cmds ...string) error {
+	for _, cmd := range cmds {
+		if _, err := io.WriteString(p.stdin, cmd+"\n"); err != nil {
+			return fmt.Errorf("error sending %q: %v", cmd, err)
+		}
+	}
+	return nil
+}
+
+// waitFor discards the output of the engine until a line for which match
+// returns true, which is returned.
+func (p *process) waitFor(match func(line string) bool, timeout time.Duration) (string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case line, ok := <-p.lines:
+			if !ok {
+				return "", errEngineExited
+			}
+			if match(line) {
+				return line, nil
+			}
+		case <-timer.C:
+			return "", errors.New("engine did not reply")
+		}
+	}
+}
+
+// close sends the quit command and kills the engine if it does not exit.
+func (p *process) close(quit string) error {
+	_ = p.send(quit)
+	p.stdin.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- p.cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(time.Second):
+		p.cmd.Process.Kill()
+		return <-done
+	}
+}
+
+func (p *process) Running() bool {
+	select {
+	case <-p.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// uciEngine drives the engine with the uci package of notnil/chess, which
+// waits for the replies of the engine indefinitely. Engines that do not reply
+// in time are given up.
+type uciEngine struct {
+	ng     *uci.Engine
+	out    *uciOutput
+	failed chan struct{}
+	once   sync.Once
+}
+
+func newUCIEngine(config EngineConfig) (*uciEngine, error) {
+	if len(config.Args) > 0 {
+		return nil, errors.New("arguments are only supported by CECP engines")
+	}
+
+	out := &uciOutput{}
+	ng, err := uci.New(config.Path, uci.Debug, uci.Logger(log.New(out, "", 0)))
+	if err != nil {
+		return nil, err
+	}
+	e := &uciEngine{ng: ng, out: out, failed: make(chan struct{})}
+
+	if err := e.init(config.Options); err != nil {
+		e.Close()
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func (e *uciEngine) init(options map[string]string) error {
+	if err := e.run(engineTimeout, uci.CmdUCI); err != nil {
+		return fmt.Errorf("error waiting for uciok: %v", err)
+	}
+
+	cmds := []uci.Cmd{}
+	for _, name := range sortedKeys(options) {
+		if !e.out.hasOption(name) {
+			return fmt.Errorf("engine has no option %q", name)
+		}
+		cmds = append(cmds, uci.CmdSetOption{Name: name, Value: options[name]})
+	}
+	cmds = append(cmds, uci.CmdIsReady)
+
+	return e.run(engineTimeout, cmds...)
+}
+
+// run runs the commands, failing the engine if they do not complete before
+// the timeout.
+func (e *uciEngine) run(timeout time.Duration, cmds ...uci.Cmd) error {
+	if !e.Running() {
+		return errEngineExited
+	}
+	done := make(chan error, 1)
+	go func() { done <- e.ng.Run(cmds...) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		e.fail()
+		return errors.New("engine did not reply")
+	}
+}
+
+func (e *uciEngine) BestMove(ctx context.Context, pos *chess.Position, dur time.Duration, info func(SearchInfo)) (*chess.Move, error) {
+	if err := e.run(engineTimeout, uci.CmdUCINewGame, uci.CmdIsReady, uci.CmdPosition{Position: pos}); err != nil {
+		return nil, err
+	}
+
+	e.out.setInfo(info)
+	defer e.out.setInfo(nil)
+
+	done := make(chan error, 1)
+	go func() { done <- e.ng.Run(uci.CmdGo{MoveTime: dur}) }()
+
+	timeout := time.NewTimer(dur + engineTimeout)
+	defer timeout.Stop()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil, fmt.Errorf("engine did not move: %v", err)
+		}
+	case <-ctx.Done():
+		// Stop does not wait for the search, the best move of the stopped
+		// search is discarded.
+		go e.ng.Run(uci.CmdStop)
+		select {
+		case <-done:
+		case <-time.After(engineTimeout):
+			e.fail()
+		}
+		return nil, ctx.Err()
+	case <-timeout.C:
+		e.fail()
+		return nil, errors.New("engine did not move")
+	}
+
+	// The search ends without a move when the output of the engine is closed.
+	move := e.ng.SearchResults().BestMove
+	if move == nil {
+		return nil, errEngineExited
+	}
+	played, err := DecodeMove(pos, move.String(), NotationUCI)
+	if err != nil {
+		return nil, fmt.Errorf("engine played %q: %v", move, err)
+	}
+	return chess.UCINotation{}.Decode(pos, played)
+}
+
+// Ping waits for the engine to process the previous commands.
+func (e *uciEngine) Ping() error {
+	return e.run(engineTimeout, uci.CmdIsReady)
+}
+
+// Running reports whether the engine has replied in time so far, the uci
+// package does not notice when the process exits.
+func (e *uciEngine) Running() bool {
+	select {
+	case <-e.failed:
+		return false
+	default:
+		return true
+	}
+}
+
+func (e *uciEngine) fail() {
+	e.once.Do(func() { close(e.failed) })
+}
+
+// Close sends the quit command and kills the engine. Engines that failed may
+// still hold the uci package, which is not waited for long.
+func (e *uciEngine) Close() error {
+	done := make(chan error, 1)
+	go func() { done <- e.ng.Close() }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(time.Second):
+		return errors.New("engine did not quit")
+	}
+}
+
+// uciOutput receives the lines exchanged with the engine from the logger of
+// the uci package, which only keeps the last info of a search and the first
+// word of the names of the options.
+type uciOutput struct {
+	mu      sync.Mutex
+	options []string
+	info    func(SearchInfo)
+}
+
+func (o *uciOutput) Write(p []byte) (int, error) {
+	line := strings.TrimSpace(string(p))
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(line, "option name "):
+		o.options = append(o.options, strings.ToLower(line))
+	case strings.HasPrefix(line, "info ") && o.info != nil:
+		var info uci.Info
+		if err := info.UnmarshalText([]byte(line)); err == nil && info.Depth > 0 {
+			o.info(SearchInfo{Depth: info.Depth, Score: info.Score.CP, Mate: info.Score.Mate})
+		}
+	}
+
+	return len(p), nil
+}
+
+func (o *uciOutput) setInfo(info func(SearchInfo)) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.info = info
+}
+
+// hasOption reports whether the engine declared the option, names are not
+// case sensitive.
+func (o *uciOutput) hasOption(name string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	prefix := "option name " + strings.ToLower(name) + " type "
+	for _, line := range o.options {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
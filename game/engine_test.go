@@ -0,0 +1,214 @@
+package game_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/notnil/chess"
+
+	"github.com/sevein/chesstempo/game"
+)
+
+func TestMain(m *testing.M) {
+	// The protocol is not given as an argument, UCI engines are started
+	// without them.
+	if protocol := os.Getenv("CHESSTEMPO_FAKE_ENGINE"); protocol != "" {
+		fakeEngine(game.Protocol(protocol))
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeEngine speaks the protocol and plays the first valid move of the
+// position, or the last one with the option Last. CECP moves are sent in SAN.
+// With the option Wait, it searches until it is stopped.
+func fakeEngine(protocol game.Protocol) {
+	pos := chess.StartingPosition()
+	last, wait := false, false
+	move := func() *chess.Move {
+		moves := pos.ValidMoves()
+		if last {
+			return moves[len(moves)-1]
+		}
+		return moves[0]
+	}
+	setPosition := func(fen string) {
+		if opt, err := chess.FEN(fen); err == nil {
+			pos = chess.NewGame(opt).Position()
+		}
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		cmd, arg := scanner.Text(), ""
+		if i := strings.Index(cmd, " "); i > 0 {
+			cmd, arg = cmd[:i], cmd[i+1:]
+		}
+		switch cmd {
+		case "uci":
+			fmt.Println("id name Fake engine")
+			fmt.Println("option name Last type check default false")
+			fmt.Println("option name Wait type check default false")
+			fmt.Println("uciok")
+		case "isready":
+			fmt.Println("readyok")
+		case "setoption":
+			switch arg {
+			case "name Last value true":
+				last = true
+			case "name Wait value true":
+				wait = true
+			}
+		case "position":
+			setPosition(strings.TrimPrefix(arg, "fen "))
+		case "protover":
+			fmt.Println(`feature ping=1 setboard=1 myname="Fake engine"`)
+			fmt.Println(`feature option="Last -check 0" option="Wait -check 0" done=1`)
+		case "option":
+			switch arg {
+			case "Last=1":
+				last = true
+			case "Wait=1":
+				wait = true
+			}
+		case "ping":
+			fmt.Println("pong " + arg)
+		case "setboard":
+			setPosition(arg)
+		case "go", "stop", "?":
+			if cmd == "go" && protocol == game.ProtocolUCI {
+				fmt.Println("info depth 1 score cp 20 pv " + move().String())
+			} else if cmd == "go" {
+				fmt.Println("1 20 0 1 " + move().String())
+			}
+			if cmd == "go" && wait {
+				continue
+			}
+			if protocol == game.ProtocolUCI {
+				fmt.Println("bestmove " + move().String())
+			} else {
+				fmt.Println("move " + chess.AlgebraicNotation{}.Encode(pos, move()))
+			}
+		case "quit":
+			return
+		}
+	}
+}
+
+func TestBot(t *testing.T) {
+	tests := []struct {
+		protocol game.Protocol
+		options  map[string]string
+		last     bool
+	}{
+		{protocol: game.ProtocolUCI},
+		{protocol: game.ProtocolUCI, options: map[string]string{"Last": "true"}, last: true},
+		{protocol: game.ProtocolCECP},
+		{protocol: game.ProtocolCECP, options: map[string]string{"Last": "1"}, last: true},
+	}
+	for _, tc := range tests {
+		t.Setenv("CHESSTEMPO_FAKE_ENGINE", string(tc.protocol))
+		bot, err := game.NewBot(game.EngineConfig{
+			Path:     os.Args[0],
+			Protocol: tc.protocol,
+			Options:  tc.options,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer bot.Stop()
+
+		if err := bot.Ping(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, fen := range []string{
+			"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+			"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+		} {
+			var info game.SearchInfo
+			move, err := bot.Play(context.Background(), fen, time.Millisecond*100, func(si game.SearchInfo) {
+				info = si
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Depth != 1 || info.Score != 20 {
+				t.Errorf("%s: got info %+v, want depth 1 and score 20", tc.protocol, info)
+			}
+			opt, _ := chess.FEN(fen)
+			moves := chess.NewGame(opt).Position().ValidMoves()
+			want := moves[0]
+			if tc.last {
+				want = moves[len(moves)-1]
+			}
+			if move.String() != want.String() {
+				t.Errorf("%s %v: got %s, want %s", tc.protocol, tc.options, move, want)
+			}
+		}
+	}
+}
+
+func TestBotUnknownOption(t *testing.T) {
+	for _, protocol := range []game.Protocol{game.ProtocolUCI, game.ProtocolCECP} {
+		t.Setenv("CHESSTEMPO_FAKE_ENGINE", string(protocol))
+		_, err := game.NewBot(game.EngineConfig{
+			Path:     os.Args[0],
+			Protocol: protocol,
+			Options:  map[string]string{"Threads": "4"},
+		})
+		if err == nil {
+			t.Errorf("%s: expected an error", protocol)
+		}
+	}
+}
+
+func TestBotCancel(t *testing.T) {
+	// Values of the option Wait.
+	for protocol, wait := range map[game.Protocol]string{game.ProtocolUCI: "true", game.ProtocolCECP: "1"} {
+		t.Setenv("CHESSTEMPO_FAKE_ENGINE", string(protocol))
+		bot, err := game.NewBot(game.EngineConfig{
+			Path:     os.Args[0],
+			Protocol: protocol,
+			Options:  map[string]string{"Wait": wait},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer bot.Stop()
+
+		// The search of a minute is stopped by the context.
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second/10)
+		defer cancel()
+		start := time.Now()
+		// Health checks do not wait for the search.
+		pinged := make(chan error, 1)
+		go func() {
+			time.Sleep(time.Second / 50)
+			pinged <- bot.Ping(ctx)
+		}()
+		if _, err := bot.Play(ctx, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", time.Minute, nil); err != context.DeadlineExceeded {
+			t.Errorf("%s: got %v, want %v", protocol, err, context.DeadlineExceeded)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second*5 {
+			t.Errorf("%s: search stopped after %s", protocol, elapsed)
+		}
+		select {
+		case err := <-pinged:
+			if err != nil {
+				t.Errorf("%s: ping during the search: %v", protocol, err)
+			}
+		default:
+			t.Errorf("%s: ping blocked by the search", protocol)
+		}
+
+		if err := bot.Ping(context.Background()); err != nil {
+			t.Errorf("%s: %v", protocol, err)
+		}
+	}
+}
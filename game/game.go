@@ -7,14 +7,71 @@ import (
 	"time"
 
 	"github.com/notnil/chess"
+	"go.opentelemetry.io/otel/attribute"
+	"go.temporal.io/sdk/temporal"
 	"go.temporal.io/sdk/workflow"
+
+	"github.com/sevein/chesstempo/tracing"
 )
 
 var ChessNotation = chess.UCINotation{}
 
 type GameWorkflowParams struct {
-	Color Color  `json:"color"` // Color chosen by the user, leave empty for a random pick.
-	FEN   string `json:"fen"`   // Initial state of the game in Forsysth-Edwards notation.
+	Color    Color   `json:"color"`              // Color chosen by the user, leave empty for a random pick.
+	FEN      string  `json:"fen"`                // Initial state of the game in Forsysth-Edwards notation.
+	ParentID string  `json:"parentId,omitempty"` // Game that this game is a rematch of.
+	Series   *Series `json:"series,omitempty"`   // Score of the series before this game.
+
+	Mode           Mode                    `json:"mode,omitempty"`           // Live (default) or correspondence.
+	Correspondence *CorrespondenceSettings `json:"correspondence,omitempty"` // Settings of correspondence games.
+	Idle           IdleTimeout             `json:"idle"`                     // Idle timeouts, set by the server's policy.
+
+	Engine      string `json:"engine,omitempty"`      // Engine playing the machine's side, empty for the default engine.
+	EngineQueue string `json:"engineQueue,omitempty"` // Task queue of the engine activities, set by the server.
+
+	// State carried over when the workflow continues as new.
+	PliesPerRun     int      `json:"pliesPerRun,omitempty"`     // Moves played before continuing as new, zero means DefaultPliesPerRun.
+	Moves           []string `json:"moves,omitempty"`           // Moves played from FEN in UCI notation.
+	PendingVacation int      `json:"pendingVacation,omitempty"` // Vacation days requested outside of the user's turn.
+}
+
+// MoveSignal is the payload of the move signal.
+type MoveSignal struct {
+	Move  string            `json:"move"`            // Move in UCI notation.
+	Trace map[string]string `json:"trace,omitempty"` // Trace context of the request.
+}
+
+// UnmarshalJSON also accepts a bare move, which is how the signal was sent
+// before it carried the trace context.
+func (s *MoveSignal) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*s = MoveSignal{}
+		return json.Unmarshal(data, &s.Move)
+	}
+
+	type alias MoveSignal
+	return json.Unmarshal(data, (*alias)(s))
+}
+
+// DefaultPliesPerRun bounds the history of a workflow run. A ply takes roughly
+// a dozen events so runs stay well below the history limits of Temporal.
+const DefaultPliesPerRun = 200
+
+func (params GameWorkflowParams) pliesPerRun() int {
+	if params.PliesPerRun > 0 {
+		return params.PliesPerRun
+	}
+	return DefaultPliesPerRun
+}
+
+// engineQueue returns the task queue of the engine activities. Games started
+// before engines had their own queue share the queue of the workflows, where
+// the main binary also registers the bot activity.
+func (params GameWorkflowParams) engineQueue(ctx workflow.Context) string {
+	if params.EngineQueue != "" {
+		return params.EngineQueue
+	}
+	return workflow.GetInfo(ctx).TaskQueueName
 }
 
 func (params *GameWorkflowParams) PickColor(ctx workflow.Context) {
@@ -39,23 +96,40 @@ func (params *GameWorkflowParams) PickColor(ctx workflow.Context) {
 // query handlers or as the final return value describing the state of the game
 type GameInfo struct {
 	FEN        string        // Position of the board.
+	StartFEN   string        // Initial position, empty for the standard one.
 	Outcome    chess.Outcome // Result of the game ("*" means "in progress").
 	Method     chess.Method  // Method that generated the outcome.
 	Board      string        // Simple viz of the board using Unicode chess symbols.
+	Moves      []string      // Moves played from the initial position in UCI notation.
 	Turn       Turn          // Current turn.
 	Color      Color         // User's color.
 	ValidMoves []string      // Valid moves when it is the user's turn.
+	ParentID   string        // Game that this game is a rematch of.
+	Series     *Series       // Score of the series before this game.
+	Mode       Mode          // Live or correspondence.
+	Engine     string        // Engine playing the machine's side.
+	AbandonAt  *time.Time    // Set when the user has been warned of inactivity.
+	Abandoned  bool          // Whether the user abandoned the game.
+	Deadline   *time.Time    // Deadline of the user's move in correspondence games.
+	Vacation   int           // Vacation days left in correspondence games.
+	TimedOut   bool          // Whether the user ran out of time.
 }
 
 // NewInfoFromGame creates a new GameInfo.
-func NewInfoFromGame(g *chess.Game, c Color, t Turn) *GameInfo {
+func NewInfoFromGame(g *chess.Game, params GameWorkflowParams, t Turn) *GameInfo {
 	info := GameInfo{
-		FEN:     g.FEN(),
-		Outcome: g.Outcome(),
-		Method:  g.Method(),
-		Board:   g.Position().Board().Draw(),
-		Turn:    t,
-		Color:   c,
+		FEN:      g.FEN(),
+		StartFEN: params.FEN,
+		Outcome:  g.Outcome(),
+		Method:   g.Method(),
+		Board:    g.Position().Board().Draw(),
+		Moves:    encodeMoves(g),
+		Turn:     t,
+		Color:    params.Color,
+		ParentID: params.ParentID,
+		Series:   params.Series,
+		Mode:     params.Mode,
+		Engine:   params.Engine,
 	}
 
 	if t == User {
@@ -153,8 +227,16 @@ func (t Turn) String() string {
 func GameWorkflow(ctx workflow.Context, params GameWorkflowParams) (*GameInfo, error) {
 	logger := workflow.GetLogger(ctx)
 
+	version := workflow.GetVersion(ctx, turnTimersChangeID, workflow.DefaultVersion, 1)
+	searchVersion := workflow.GetVersion(ctx, cancelSearchChangeID, workflow.DefaultVersion, 1)
+
 	params.PickColor(ctx)
-	logger.Info("New game", "user", params.Color)
+	if len(params.Moves) == 0 {
+		logger.Info("New game", "user", params.Color, "parent", params.ParentID)
+		observe(ctx, func() { gamesStarted.WithLabelValues(string(params.Mode)).Inc() })
+	} else {
+		logger.Info("Game continued as new", "user", params.Color, "moves", len(params.Moves))
+	}
 
 	// Options of the game.
 	opts := []func(*chess.Game){
@@ -177,27 +259,223 @@ func GameWorkflow(ctx workflow.Context, params GameWorkflowParams) (*GameInfo, e
 		turn = Machine
 	}
 
+	// Replay the moves carried over from the previous run.
+	for _, m := range params.Moves {
+		move, err := chess.UCINotation{}.Decode(game.Position(), m)
+		if err != nil {
+			return nil, err
+		}
+		if err := game.Move(move); err != nil {
+			return nil, err
+		}
+	}
+	if len(params.Moves) > 0 {
+		turn = User
+		if game.Position().Turn() != params.Color.Chess() {
+			turn = Machine
+		}
+	}
+
+	// Inactivity of the user, tracked during its turn.
+	var idle *idleTimer
+	abandoned := false
+
+	// Deadlines of correspondence games.
+	var deadline *moveDeadline
+	vacation := 0
+	timedOut := false
+	pendingVacation := params.PendingVacation
+	if params.Correspondence != nil {
+		vacation = params.Correspondence.VacationDays
+	}
+
+	gameInfo := func() *GameInfo {
+		info := NewInfoFromGame(game, params, turn)
+		info.AbandonAt = idle.deadline()
+		info.Abandoned = abandoned
+		info.Vacation = vacation
+		info.TimedOut = timedOut
+		if deadline != nil {
+			at := deadline.at
+			info.Deadline = &at
+		}
+		return info
+	}
+
+	// Vacation requested when there is no deadline running is postponed until
+	// the next turn of the user.
+	takeVacation := func(days int) {
+		if days > vacation-pendingVacation {
+			days = vacation - pendingVacation
+		}
+		if days <= 0 {
+			return
+		}
+		if deadline == nil {
+			pendingVacation += days
+			return
+		}
+		vacation -= days
+		deadline.extend(days)
+		idle.extend(day * time.Duration(days))
+		logger.Info("Vacation taken", "days", days, "left", vacation)
+	}
+
+	notification := func(kind NotificationKind, at time.Time) Notification {
+		return Notification{
+			GameID:   workflow.GetInfo(ctx).WorkflowExecution.ID,
+			Kind:     kind,
+			To:       params.Correspondence.Notify,
+			Deadline: at,
+			FEN:      game.FEN(),
+		}
+	}
+
 	// Query handler to provide the state of the game.
 	workflow.SetQueryHandler(ctx, "info", func() (*GameInfo, error) {
-		return NewInfoFromGame(game, params.Color, turn), nil
+		return gameInfo(), nil
 	})
 
 	// Couple of signals so the user can decide the next move.
 	resignSignalChan := workflow.GetSignalChannel(ctx, "resign")
 	moveSignalChan := workflow.GetSignalChannel(ctx, "move")
-	moveRequest := ""
+	vacationSignalChan := workflow.GetSignalChannel(ctx, "vacation")
+	drawSignalChan := workflow.GetSignalChannel(ctx, "draw")
+	moveRequest := MoveSignal{}
+
+	// The machine accepts the draws offered by the user only when they can
+	// be claimed, i.e. threefold repetition or the fifty-move rule.
+	offerDraw := func() {
+		for _, method := range game.EligibleDraws() {
+			if method == chess.DrawOffer {
+				continue
+			}
+			if err := game.Draw(method); err == nil {
+				logger.Info("Draw claimed", "method", method.String())
+				return
+			}
+		}
+	}
 
-	// Create selector to consume the signal channels.
-	selector := workflow.NewSelector(ctx)
-	selector.AddReceive(resignSignalChan, func(ch workflow.ReceiveChannel, _ bool) {
+	onResign := func(ch workflow.ReceiveChannel, _ bool) {
 		var signal interface{}
 		ch.Receive(ctx, &signal)
 
 		game.Resign(params.Color.Chess())
-	})
-	selector.AddReceive(moveSignalChan, func(ch workflow.ReceiveChannel, _ bool) {
-		ch.Receive(ctx, &moveRequest)
-	})
+	}
+	onDraw := func(ch workflow.ReceiveChannel, _ bool) {
+		var signal interface{}
+		ch.Receive(ctx, &signal)
+
+		offerDraw()
+	}
+
+	// Create selector to consume the signal channels.
+	newSelector := func() workflow.Selector {
+		selector := workflow.NewSelector(ctx)
+		selector.AddReceive(resignSignalChan, onResign)
+		selector.AddReceive(moveSignalChan, func(ch workflow.ReceiveChannel, _ bool) {
+			ch.Receive(ctx, &moveRequest)
+		})
+		selector.AddReceive(vacationSignalChan, func(ch workflow.ReceiveChannel, _ bool) {
+			var days int
+			ch.Receive(ctx, &days)
+
+			takeVacation(days)
+		})
+		selector.AddReceive(drawSignalChan, onDraw)
+		return selector
+	}
+
+	// The signals that may end the game during the machine's turn, which
+	// cancel the search.
+	interruptSearch := func(selector workflow.Selector) {
+		selector.AddReceive(resignSignalChan, onResign)
+		selector.AddReceive(drawSignalChan, onDraw)
+	}
+	cancelSearch := searchVersion != workflow.DefaultVersion
+
+	// Receive the signals that are pending, if any. It returns true when the
+	// user has moved or the game is over.
+	drainSignals := func() bool {
+		var signal interface{}
+		if resignSignalChan.ReceiveAsync(&signal) {
+			game.Resign(params.Color.Chess())
+			return true
+		}
+		for drawSignalChan.ReceiveAsync(&signal) {
+			offerDraw()
+		}
+		if game.Outcome() != chess.NoOutcome {
+			return true
+		}
+
+		var days int
+		for vacationSignalChan.ReceiveAsync(&days) {
+			takeVacation(days)
+		}
+
+		return moveSignalChan.ReceiveAsync(&moveRequest)
+	}
+
+	// Continue as new carrying over the state of the game.
+	continueAsNew := func() error {
+		next := params
+		next.Moves = encodeMoves(game)
+		next.PendingVacation = pendingVacation
+		if params.Correspondence != nil {
+			settings := *params.Correspondence
+			settings.VacationDays = vacation
+			next.Correspondence = &settings
+		}
+		logger.Info("Continuing as new", "moves", len(next.Moves))
+		return workflow.NewContinueAsNewError(ctx, GameWorkflow, next)
+	}
+
+	// Block until the user sends us the next move, resigns or runs out of time.
+	// The warning only wakes us up to update the state.
+	waitForUser := func() error {
+		// Keep the history bounded, unless the user has already moved.
+		if len(game.Moves())-len(params.Moves) >= params.pliesPerRun() && !drainSignals() {
+			return continueAsNew()
+		}
+
+		selector := newSelector()
+		idle = newIdleTimer(ctx, selector, params.Idle)
+		if params.Correspondence != nil {
+			deadline = newMoveDeadline(ctx, selector, params.Correspondence.DaysPerMove, func(at time.Time) {
+				notify(ctx, notification(Reminder, at))
+			})
+			notify(ctx, notification(YourTurn, deadline.at))
+			if days := pendingVacation; days > 0 {
+				pendingVacation = 0
+				takeVacation(days)
+			}
+		}
+		for moveRequest.Move == "" && game.Outcome() == chess.NoOutcome && !idle.abandoned && (deadline == nil || !deadline.expired) {
+			selector.Select(ctx)
+		}
+		idle.stop()
+
+		if idle.abandoned {
+			logger.Warn("Game abandoned by the user")
+			abandoned = true
+			game.Resign(params.Color.Chess())
+		}
+		idle = nil
+
+		if deadline != nil {
+			deadline.stop()
+			if deadline.expired {
+				logger.Warn("User ran out of time")
+				timedOut = true
+				game.Resign(params.Color.Chess())
+			}
+			deadline = nil
+		}
+
+		return nil
+	}
 
 	// Game loop.
 	for game.Outcome() == chess.NoOutcome {
@@ -209,18 +487,39 @@ func GameWorkflow(ctx workflow.Context, params GameWorkflowParams) (*GameInfo, e
 			// student could be to refactor this piece using workflow activities
 			// and have an activity worker play the game using a chess engine
 			// like stockfish.
-			if err = machinesMove(ctx, game, turn); err != nil {
-				return NewInfoFromGame(game, params.Color, turn), err
+			// The reply joins the trace of the user's move, if any.
+			spanCtx, end := tracing.StartWorkflowSpan(
+				tracing.WithCarrier(ctx, moveRequest.Trace),
+				"GameWorkflow.machinesMove",
+				attribute.String("game.id", workflow.GetInfo(ctx).WorkflowExecution.ID),
+				attribute.Int("game.ply", len(game.Moves())),
+			)
+			err = machinesMove(spanCtx, game, params.engineQueue(ctx), cancelSearch, interruptSearch)
+			end()
+			if err != nil {
+				return gameInfo(), err
 			}
 		}
 
 		// User's turn.
 		if turn == User {
-			// Block until the user sends us the next move.
-			moveRequest = ""
-			selector.Select(ctx)
-			if moveRequest != "" {
-				err = game.MoveStr(moveRequest)
+			moveRequest = MoveSignal{}
+
+			if version == workflow.DefaultVersion {
+				// Games started before timers were introduced wait for
+				// the user indefinitely.
+				selector := newSelector()
+				selector.Select(ctx)
+				for moveRequest.Move == "" && game.Outcome() == chess.NoOutcome &&
+					workflow.GetVersion(ctx, legacyWaitChangeID, workflow.DefaultVersion, 1) != workflow.DefaultVersion {
+					selector.Select(ctx)
+				}
+			} else if err := waitForUser(); err != nil {
+				return nil, err
+			}
+
+			if moveRequest.Move != "" {
+				err = game.MoveStr(moveRequest.Move)
 			}
 		}
 
@@ -233,45 +532,148 @@ func GameWorkflow(ctx workflow.Context, params GameWorkflowParams) (*GameInfo, e
 	}
 
 	logger.Warn("Game over!", "outcome", game.Outcome().String())
+	observe(ctx, func() {
+		gamesFinished.WithLabelValues(game.Outcome().String(), game.Method().String()).Inc()
+		gameMoves.Observe(float64(len(game.Moves())))
+	})
 
-	return NewInfoFromGame(game, params.Color, turn), nil
+	return gameInfo(), nil
 }
 
-// machinesMove attempts to move using an activity worker, but it will choose
-// a random move if the activity timed out, e.g. worker not present.
-func machinesMove(ctx workflow.Context, game *chess.Game, turn Turn) error {
-	logger := workflow.GetLogger(ctx)
+// botHeartbeatTimeout bounds the time the bot activity goes without a
+// heartbeat, which is how it learns that it was canceled.
+const botHeartbeatTimeout = time.Second * 2
 
-	var move string
-	opts := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
-		TaskQueue:              "queue",
-		ScheduleToCloseTimeout: time.Second * 5,
-		StartToCloseTimeout:    time.Second * 5,
-	})
-	err := workflow.ExecuteActivity(opts, BotActivityName, game.FEN()).Get(ctx, &move)
-	if err == nil {
-		return game.MoveStr(move)
-	}
+// Time given to the bot activity to move, which includes the time that it
+// waits for a worker. It doubles every time that the activity times out.
+const (
+	engineWait    = time.Minute
+	maxEngineWait = time.Hour
+)
 
-	if strings.Contains(err.Error(), "ActivityNotRegisteredError") {
-		logger.Warn("Bot activity worker timed out, next move will be random")
+// machinesMove attempts to move using an activity worker listening on queue.
+// The machine plays a random move if the activity is not registered or the
+// engine is not available, but waits for the engine when the activity times
+// out, e.g. no worker polls the queue. When cancelSearch is set, the activity
+// is canceled if the game ends first, e.g. the user resigns, which interrupt
+// adds to the selector that waits for the activity.
+func machinesMove(ctx workflow.Context, game *chess.Game, queue string, cancelSearch bool, interrupt func(workflow.Selector)) error {
+	logger := workflow.GetLogger(ctx)
 
-		move := ""
-		moves := validMoves(game)
+	var (
+		move string
+		err  error
+	)
+	if cancelSearch {
+		move, err = searchMove(ctx, game, queue, engineWait, interrupt)
+	} else {
+		opts := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+			TaskQueue:              queue,
+			ScheduleToCloseTimeout: time.Second * 5,
+			StartToCloseTimeout:    time.Second * 5,
+		})
+		err = workflow.ExecuteActivity(opts, BotActivityName, game.FEN()).Get(ctx, &move)
+	}
 
-		if err := workflow.SideEffect(ctx, func(ctx workflow.Context) interface{} {
-			move := moves[rand.Intn(len(moves))]
-			return move
-		}).Get(&move); err != nil {
+	for wait := engineWait; temporal.IsTimeoutError(err); {
+		// Games failed when the engine timed out before, only unregistered
+		// activities were replaced by a random move.
+		if workflow.GetVersion(ctx, engineWaitChangeID, workflow.DefaultVersion, 1) == workflow.DefaultVersion {
 			return err
 		}
+		logger.Warn("Engine did not move, waiting for it", "queue", queue, "wait", wait)
+		observe(ctx, func() { engineTimeouts.WithLabelValues(queue).Inc() })
+
+		if wait *= 2; wait > maxEngineWait {
+			wait = maxEngineWait
+		}
+		move, err = searchMove(ctx, game, queue, wait, interrupt)
+	}
 
+	switch {
+	case err == nil && move == "":
+		return nil // The game is over.
+	case err == nil:
 		return game.MoveStr(move)
+	case strings.Contains(err.Error(), "ActivityNotRegisteredError"):
+		return randomMove(ctx, game, "not_registered")
+	case isEngineUnavailable(err):
+		return randomMove(ctx, game, "unavailable")
 	}
 
 	return err
 }
 
+// searchMove runs the bot activity, giving it wait to move. It returns no move
+// when the game ends first, in which case the activity is canceled.
+func searchMove(ctx workflow.Context, game *chess.Game, queue string, wait time.Duration, interrupt func(workflow.Selector)) (string, error) {
+	timeout := time.Second * 5
+	if isRemoteBotQueue(queue) {
+		timeout = remoteBotTimeout
+	}
+	searchCtx, cancel := workflow.WithCancel(ctx)
+	defer cancel()
+	opts := workflow.WithActivityOptions(searchCtx, workflow.ActivityOptions{
+		TaskQueue:              queue,
+		ScheduleToCloseTimeout: wait,
+		StartToCloseTimeout:    timeout,
+		HeartbeatTimeout:       botHeartbeatTimeout,
+	})
+	future := workflow.ExecuteActivity(opts, BotActivityName, game.FEN())
+
+	var (
+		move string
+		err  error
+		done bool
+	)
+	selector := workflow.NewSelector(ctx)
+	selector.AddFuture(future, func(f workflow.Future) {
+		err = f.Get(ctx, &move)
+		done = true
+	})
+	interrupt(selector)
+	for !done && game.Outcome() == chess.NoOutcome {
+		selector.Select(ctx)
+	}
+	if !done {
+		workflow.GetLogger(ctx).Info("Game over during the search, canceling it")
+		return "", nil
+	}
+
+	return move, err
+}
+
+// randomMove plays a random move when the engine is not available.
+func randomMove(ctx workflow.Context, game *chess.Game, reason string) error {
+	workflow.GetLogger(ctx).Warn("Engine not available, the move will be random", "reason", reason)
+	observe(ctx, func() { randomMoves.WithLabelValues(reason).Inc() })
+
+	move := ""
+	moves := validMoves(game)
+
+	if err := workflow.SideEffect(ctx, func(ctx workflow.Context) interface{} {
+		move := moves[rand.Intn(len(moves))]
+		return move
+	}).Get(&move); err != nil {
+		return err
+	}
+
+	return game.MoveStr(move)
+}
+
+// encodeMoves returns the moves of the game encoded using UCI notation.
+func encodeMoves(game *chess.Game) []string {
+	moves := game.Moves()
+	positions := game.Positions()
+
+	ret := make([]string, len(moves))
+	for i, m := range moves {
+		ret[i] = chess.UCINotation{}.Encode(positions[i], m)
+	}
+
+	return ret
+}
+
 // validMoves returns a slice of valid moves encoded using ChessNotation.
 func validMoves(game *chess.Game) []string {
 	pos := game.Position()
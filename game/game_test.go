@@ -0,0 +1,392 @@
+package game_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/notnil/chess"
+	"go.temporal.io/api/enums/v1"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+
+	"github.com/sevein/chesstempo/game"
+)
+
+func TestGameWorkflowDraw(t *testing.T) {
+	t.Parallel()
+
+	// Both sides shuffle their knights until the initial position is
+	// repeated three times, then the user offers a draw twice. The machine
+	// declines the first offer since the draw cannot be claimed yet.
+	userMoves := []string{"g1f3", "f3g1", "g1f3", "f3g1"}
+	machineMoves := []string{"g8f6", "f6g8", "g8f6", "f6g8"}
+
+	s := testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(game.GameWorkflow)
+	env.RegisterActivityWithOptions(func(ctx context.Context, fen string) (string, error) {
+		move := machineMoves[0]
+		machineMoves = machineMoves[1:]
+		return move, nil
+	}, activity.RegisterOptions{Name: game.BotActivityName})
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("draw", struct{}{})
+	}, time.Minute/2)
+	for i, move := range userMoves {
+		move := move
+		env.RegisterDelayedCallback(func() {
+			env.SignalWorkflow("move", game.MoveSignal{Move: move})
+		}, time.Minute*time.Duration(i+1))
+	}
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("draw", struct{}{})
+	}, time.Minute*time.Duration(len(userMoves)+1))
+
+	env.ExecuteWorkflow(game.GameWorkflow, game.GameWorkflowParams{Color: game.White})
+
+	if !env.IsWorkflowCompleted() {
+		t.Fatal("workflow did not complete")
+	}
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatal(err)
+	}
+	info := game.GameInfo{}
+	if err := env.GetWorkflowResult(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Outcome != chess.Draw || info.Method != chess.ThreefoldRepetition {
+		t.Errorf("got %s by %s, want draw by threefold repetition", info.Outcome, info.Method)
+	}
+	if len(info.Moves) != 8 {
+		t.Errorf("got %d moves, want 8", len(info.Moves))
+	}
+}
+
+func TestGameWorkflowResignDuringSearch(t *testing.T) {
+	t.Parallel()
+
+	// The machine opens, but its search does not end before the user
+	// resigns, which ends the game without waiting for the search.
+	searching := make(chan struct{})
+	t.Cleanup(func() { close(searching) })
+
+	s := testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(game.GameWorkflow)
+	env.RegisterActivityWithOptions(func(ctx context.Context, fen string) (string, error) {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-searching:
+			return "", context.Canceled
+		}
+	}, activity.RegisterOptions{Name: game.BotActivityName})
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("resign", struct{}{})
+	}, time.Second)
+
+	env.ExecuteWorkflow(game.GameWorkflow, game.GameWorkflowParams{Color: game.Black})
+
+	if !env.IsWorkflowCompleted() {
+		t.Fatal("workflow did not complete")
+	}
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatal(err)
+	}
+	info := game.GameInfo{}
+	if err := env.GetWorkflowResult(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Outcome != chess.WhiteWon || info.Method != chess.Resignation {
+		t.Errorf("got %s by %s, want white won by resignation", info.Outcome, info.Method)
+	}
+	if len(info.Moves) != 0 {
+		t.Errorf("got %d moves, want none", len(info.Moves))
+	}
+}
+
+func TestGameWorkflowContinueAsNew(t *testing.T) {
+	t.Parallel()
+
+	// firstMove is the activity of the machine, it plays the first valid
+	// move of the position.
+	firstMove := func(ctx context.Context, fen string) (string, error) {
+		opt, err := chess.FEN(fen)
+		if err != nil {
+			return "", err
+		}
+		pos := chess.NewGame(opt).Position()
+		return chess.UCINotation{}.Encode(pos, pos.ValidMoves()[0]), nil
+	}
+
+	// The first run ends after a move of each side. The user takes two
+	// vacation days during its turn and one more after moving, which is
+	// postponed until the next turn.
+	s := testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(game.GameWorkflow)
+	env.RegisterActivityWithOptions(firstMove, activity.RegisterOptions{Name: game.BotActivityName})
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("vacation", 2)
+	}, time.Hour)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("move", game.MoveSignal{Move: "e2e4"})
+		env.SignalWorkflow("vacation", 1)
+	}, time.Hour*2)
+
+	env.ExecuteWorkflow(game.GameWorkflow, game.GameWorkflowParams{
+		Color:          game.White,
+		Mode:           game.Correspondence,
+		Correspondence: &game.CorrespondenceSettings{DaysPerMove: 3, VacationDays: 5},
+		PliesPerRun:    2,
+	})
+
+	if !env.IsWorkflowCompleted() {
+		t.Fatal("workflow did not complete")
+	}
+	var continued *workflow.ContinueAsNewError
+	if err := env.GetWorkflowError(); !errors.As(err, &continued) {
+		t.Fatalf("got %v, want the workflow to continue as new", err)
+	}
+	next := game.GameWorkflowParams{}
+	if err := converter.GetDefaultDataConverter().FromPayloads(continued.Input, &next); err != nil {
+		t.Fatal(err)
+	}
+	moves := []string{"e2e4", "b8a6"}
+	if !reflect.DeepEqual(next.Moves, moves) {
+		t.Errorf("got moves %v, want %v", next.Moves, moves)
+	}
+	if next.Correspondence == nil || next.Correspondence.VacationDays != 3 || next.PendingVacation != 1 {
+		t.Errorf("got correspondence %+v and pending vacation %d, want 3 days left and 1 pending", next.Correspondence, next.PendingVacation)
+	}
+
+	// The new run resumes the game, taking the pending vacation day in the
+	// first turn of the user.
+	env = s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(game.GameWorkflow)
+	env.RegisterActivityWithOptions(firstMove, activity.RegisterOptions{Name: game.BotActivityName})
+	start := env.Now()
+	var info game.GameInfo
+	env.RegisterDelayedCallback(func() {
+		value, err := env.QueryWorkflow("info")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if err := value.Get(&info); err != nil {
+			t.Error(err)
+		}
+		env.SignalWorkflow("resign", struct{}{})
+	}, time.Hour)
+
+	env.ExecuteWorkflow(game.GameWorkflow, next)
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "r1bqkbnr/pppppppp/n7/8/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 1 2"; info.FEN != want {
+		t.Errorf("got FEN %q, want %q", info.FEN, want)
+	}
+	if !reflect.DeepEqual(info.Moves, moves) {
+		t.Errorf("got moves %v, want %v", info.Moves, moves)
+	}
+	if want := start.Add(time.Hour * 24 * 4); info.Deadline == nil || !info.Deadline.Equal(want) {
+		t.Errorf("got deadline %v, want %v", info.Deadline, want)
+	}
+	if info.Vacation != 2 {
+		t.Errorf("got %d vacation days, want 2", info.Vacation)
+	}
+}
+
+func TestGameWorkflowContinueAsNewBlack(t *testing.T) {
+	t.Parallel()
+
+	// The user plays black, the turn of the resumed game depends on the
+	// number of moves carried over.
+	tests := []struct {
+		moves    []string
+		searches int // Moves asked to the machine before the turn of the user.
+	}{
+		{[]string{"e2e4", "e7e5", "b1c3"}, 0},
+		{[]string{"e2e4", "e7e5"}, 1},
+	}
+	for _, tt := range tests {
+		var fens []string
+		s := testsuite.WorkflowTestSuite{}
+		env := s.NewTestWorkflowEnvironment()
+		env.RegisterWorkflow(game.GameWorkflow)
+		env.RegisterActivityWithOptions(func(ctx context.Context, fen string) (string, error) {
+			fens = append(fens, fen)
+			return "g1f3", nil
+		}, activity.RegisterOptions{Name: game.BotActivityName})
+		var info game.GameInfo
+		env.RegisterDelayedCallback(func() {
+			value, err := env.QueryWorkflow("info")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if err := value.Get(&info); err != nil {
+				t.Error(err)
+			}
+			env.SignalWorkflow("resign", struct{}{})
+		}, time.Hour)
+
+		env.ExecuteWorkflow(game.GameWorkflow, game.GameWorkflowParams{Color: game.Black, Moves: tt.moves})
+
+		if err := env.GetWorkflowError(); err != nil {
+			t.Fatalf("moves %v: %v", tt.moves, err)
+		}
+		if len(fens) != tt.searches {
+			t.Errorf("moves %v: machine was asked to move in %v, want %d searches", tt.moves, fens, tt.searches)
+		}
+		if info.Turn != game.User {
+			t.Errorf("moves %v: got turn %v, want the user's turn", tt.moves, info.Turn)
+		}
+	}
+}
+
+func TestGameWorkflowLegacySignals(t *testing.T) {
+	t.Parallel()
+
+	// Games started before the turn timers keep waiting for the move of the
+	// user when a draw offer or a vacation request arrives.
+	s := testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(game.GameWorkflow)
+	env.RegisterActivityWithOptions(func(ctx context.Context, fen string) (string, error) {
+		return "e7e5", nil
+	}, activity.RegisterOptions{Name: game.BotActivityName})
+	env.OnGetVersion("turn-timers", workflow.DefaultVersion, 1).Return(workflow.DefaultVersion)
+	env.OnGetVersion("cancel-search", workflow.DefaultVersion, 1).Return(workflow.DefaultVersion)
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("draw", struct{}{})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("vacation", 1)
+	}, time.Minute*2)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("move", game.MoveSignal{Move: "e2e4"})
+	}, time.Minute*3)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("resign", struct{}{})
+	}, time.Minute*4)
+
+	env.ExecuteWorkflow(game.GameWorkflow, game.GameWorkflowParams{Color: game.White})
+
+	if !env.IsWorkflowCompleted() {
+		t.Fatal("workflow did not complete")
+	}
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatal(err)
+	}
+	info := game.GameInfo{}
+	if err := env.GetWorkflowResult(&info); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"e2e4", "e7e5"}; !reflect.DeepEqual(info.Moves, want) {
+		t.Errorf("got moves %v, want %v", info.Moves, want)
+	}
+	if info.Outcome != chess.BlackWon || info.Method != chess.Resignation {
+		t.Errorf("got %s by %s, want black won by resignation", info.Outcome, info.Method)
+	}
+}
+
+func TestGameWorkflowEngineTimeout(t *testing.T) {
+	t.Parallel()
+
+	// The engine times out once, e.g. no worker polls its queue, and the
+	// game waits for it instead of playing a random move.
+	s := testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(game.GameWorkflow)
+	searches := 0
+	env.RegisterActivityWithOptions(func(ctx context.Context, fen string) (string, error) {
+		if searches++; searches == 1 {
+			return "", temporal.NewTimeoutError(enums.TIMEOUT_TYPE_SCHEDULE_TO_CLOSE, nil)
+		}
+		return "e7e5", nil
+	}, activity.RegisterOptions{Name: game.BotActivityName})
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("move", game.MoveSignal{Move: "e2e4"})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("resign", struct{}{})
+	}, time.Hour)
+
+	env.ExecuteWorkflow(game.GameWorkflow, game.GameWorkflowParams{Color: game.White})
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatal(err)
+	}
+	info := game.GameInfo{}
+	if err := env.GetWorkflowResult(&info); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"e2e4", "e7e5"}; !reflect.DeepEqual(info.Moves, want) {
+		t.Errorf("got moves %v, want %v", info.Moves, want)
+	}
+	if searches != 2 {
+		t.Errorf("got %d searches, want 2", searches)
+	}
+}
+
+func TestGameWorkflowLegacyEngineTimeout(t *testing.T) {
+	t.Parallel()
+
+	// Games started before the engine wait fail when the engine times out.
+	s := testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(game.GameWorkflow)
+	env.RegisterActivityWithOptions(func(ctx context.Context, fen string) (string, error) {
+		return "", temporal.NewTimeoutError(enums.TIMEOUT_TYPE_SCHEDULE_TO_CLOSE, nil)
+	}, activity.RegisterOptions{Name: game.BotActivityName})
+	env.OnGetVersion("engine-wait", workflow.DefaultVersion, 1).Return(workflow.DefaultVersion)
+
+	env.ExecuteWorkflow(game.GameWorkflow, game.GameWorkflowParams{Color: game.Black})
+
+	var activityErr *temporal.ActivityError
+	if err := env.GetWorkflowError(); !errors.As(err, &activityErr) || !temporal.IsTimeoutError(activityErr) {
+		t.Fatalf("got %v, want the timeout of the activity", err)
+	}
+}
+
+func TestGameWorkflowEngineUnavailable(t *testing.T) {
+	t.Parallel()
+
+	// The machine plays a random move when the engine did not start.
+	s := testsuite.WorkflowTestSuite{}
+	env := s.NewTestWorkflowEnvironment()
+	env.RegisterWorkflow(game.GameWorkflow)
+	env.RegisterActivityWithOptions(game.UnavailableBotActivity, activity.RegisterOptions{Name: game.BotActivityName})
+
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("move", game.MoveSignal{Move: "e2e4"})
+	}, time.Minute)
+	env.RegisterDelayedCallback(func() {
+		env.SignalWorkflow("resign", struct{}{})
+	}, time.Minute*2)
+
+	env.ExecuteWorkflow(game.GameWorkflow, game.GameWorkflowParams{Color: game.White})
+
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatal(err)
+	}
+	info := game.GameInfo{}
+	if err := env.GetWorkflowResult(&info); err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Moves) != 2 {
+		t.Errorf("got moves %v, want the move of the user and a random one", info.Moves)
+	}
+}
@@ -0,0 +1,122 @@
+package game
+
+import (
+	"time"
+
+	"go.temporal.io/sdk/workflow"
+)
+
+// Mode of the game.
+type Mode string
+
+const (
+	Live           Mode = "live"
+	Correspondence Mode = "correspondence"
+)
+
+// IdleTimeout describes how long a game waits for the user to move.
+type IdleTimeout struct {
+	Warn    time.Duration `json:"warn"`    // Inactivity before the user is warned, zero disables it.
+	Abandon time.Duration `json:"abandon"` // Inactivity before the game is abandoned, zero disables it.
+}
+
+// IdlePolicy is the server-level choice of idle timeouts for each mode.
+type IdlePolicy struct {
+	Live           IdleTimeout
+	Correspondence IdleTimeout
+}
+
+// DefaultIdlePolicy is used unless the server is configured otherwise.
+var DefaultIdlePolicy = IdlePolicy{
+	Live: IdleTimeout{
+		Warn:    time.Minute * 5,
+		Abandon: time.Minute * 10,
+	},
+	Correspondence: IdleTimeout{
+		Warn:    time.Hour * 24 * 7,
+		Abandon: time.Hour * 24 * 14,
+	},
+}
+
+// For returns the timeouts that apply to games in the given mode.
+func (p IdlePolicy) For(mode Mode) IdleTimeout {
+	if mode == Correspondence {
+		return p.Correspondence
+	}
+	return p.Live
+}
+
+// idleTimer tracks the inactivity of the user during its turn.
+type idleTimer struct {
+	ctx       workflow.Context
+	selector  workflow.Selector
+	timeout   IdleTimeout
+	cancel    workflow.CancelFunc
+	since     time.Time
+	warned    bool
+	abandoned bool
+}
+
+// newIdleTimer adds the idle timers to the selector used to wait for the user.
+// The timers are cancelled with stop once the user makes a move.
+func newIdleTimer(ctx workflow.Context, selector workflow.Selector, t IdleTimeout) *idleTimer {
+	it := &idleTimer{ctx: ctx, selector: selector, timeout: t}
+	it.arm(workflow.Now(ctx))
+	return it
+}
+
+// arm starts the timers counting the inactivity from the given time. The
+// warning is skipped when it is already due, i.e. the user was warned before
+// the timers were extended.
+func (it *idleTimer) arm(since time.Time) {
+	it.stop()
+
+	ctx, cancel := workflow.WithCancel(it.ctx)
+	it.cancel = cancel
+	it.since = since
+
+	t := it.timeout
+	elapsed := workflow.Now(ctx).Sub(since)
+
+	if t.Warn > 0 && (t.Abandon == 0 || t.Warn < t.Abandon) {
+		if warnIn := t.Warn - elapsed; warnIn > 0 {
+			it.warned = false
+			it.selector.AddFuture(workflow.NewTimer(ctx, warnIn), func(f workflow.Future) {
+				if f.Get(ctx, nil) == nil {
+					it.warned = true
+				}
+			})
+		} else {
+			it.warned = true
+		}
+	}
+
+	if t.Abandon > 0 {
+		it.selector.AddFuture(workflow.NewTimer(ctx, t.Abandon-elapsed), func(f workflow.Future) {
+			if f.Get(ctx, nil) == nil {
+				it.abandoned = true
+			}
+		})
+	}
+}
+
+// extend postpones the timers, e.g. when the user takes vacation days.
+func (it *idleTimer) extend(d time.Duration) {
+	it.arm(it.since.Add(d))
+}
+
+func (it *idleTimer) stop() {
+	if it.cancel != nil {
+		it.cancel()
+	}
+}
+
+// deadline returns when the game is going to be abandoned once the user has
+// been warned.
+func (it *idleTimer) deadline() *time.Time {
+	if it == nil || !it.warned || it.timeout.Abandon == 0 {
+		return nil
+	}
+	t := it.since.Add(it.timeout.Abandon)
+	return &t
+}
@@ -0,0 +1,54 @@
+package game
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.temporal.io/sdk/workflow"
+)
+
+var (
+	gamesStarted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chesstempo_games_started_total",
+		Help: "Number of games started.",
+	}, []string{"mode"})
+
+	gamesFinished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chesstempo_games_finished_total",
+		Help: "Number of games finished by outcome and method.",
+	}, []string{"outcome", "method"})
+
+	gameMoves = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "chesstempo_game_moves",
+		Help:    "Plies played in finished games.",
+		Buckets: []float64{10, 20, 40, 60, 80, 100, 150, 200, 300},
+	})
+
+	randomMoves = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chesstempo_random_moves_total",
+		Help: "Number of machine moves chosen at random because the engine was unavailable.",
+	}, []string{"reason"})
+
+	engineTimeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chesstempo_engine_timeouts_total",
+		Help: "Number of engine searches that timed out, e.g. no worker polls the task queue.",
+	}, []string{"queue"})
+
+	engineThinkTime = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "chesstempo_engine_think_seconds",
+		Help:    "Time taken by the engine to choose a move.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	engineFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chesstempo_engine_failures_total",
+		Help: "Number of searches that failed in the engine.",
+	})
+)
+
+// observe updates metrics from workflow code. Events are only counted the
+// first time they happen, not when the history is replayed.
+func observe(ctx workflow.Context, fn func()) {
+	if !workflow.IsReplaying(ctx) {
+		fn()
+	}
+}
@@ -0,0 +1,144 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+// Notation of the moves sent and received by clients. Games are always played
+// in UCI notation, which is the notation of the move signal.
+type Notation string
+
+const (
+	NotationAuto Notation = ""    // Detected when decoding, UCI when encoding.
+	NotationUCI  Notation = "uci" // e2e4, e7e8q.
+	NotationSAN  Notation = "san" // e4, Nf3, O-O, exd8=Q+.
+	NotationLAN  Notation = "lan" // e2e4, Ng1f3, O-O, e7xd8=Q+.
+)
+
+var ErrIllegalMove = errors.New("illegal move")
+
+// ParseNotation returns the notation with the given name, "auto" is accepted.
+func ParseNotation(name string) (Notation, error) {
+	switch n := Notation(strings.ToLower(name)); n {
+	case NotationAuto, NotationUCI, NotationSAN, NotationLAN:
+		return n, nil
+	case "auto":
+		return NotationAuto, nil
+	}
+	return "", fmt.Errorf("unknown notation %q", name)
+}
+
+func (n Notation) chess() chess.Notation {
+	switch n {
+	case NotationSAN:
+		return chess.AlgebraicNotation{}
+	case NotationLAN:
+		return chess.LongAlgebraicNotation{}
+	}
+	return chess.UCINotation{}
+}
+
+// Encode encodes a move of the position.
+func (n Notation) Encode(pos *chess.Position, m *chess.Move) string {
+	return n.chess().Encode(pos, m)
+}
+
+// DecodeMove decodes a legal move of the position and returns it in UCI
+// notation. The notation is detected when n is NotationAuto.
+func DecodeMove(pos *chess.Position, s string, n Notation) (string, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "0-0") {
+		s = strings.ReplaceAll(s, "0", "O") // Castling written with zeros.
+	}
+
+	var decoders []chess.Notation
+	switch n {
+	case NotationAuto:
+		decoders = []chess.Notation{chess.UCINotation{}, chess.AlgebraicNotation{}, chess.LongAlgebraicNotation{}}
+	case NotationUCI:
+		decoders = []chess.Notation{chess.UCINotation{}}
+		s = strings.ToLower(s)
+	default:
+		decoders = []chess.Notation{n.chess()}
+	}
+
+	for _, decoder := range decoders {
+		m, err := decoder.Decode(pos, s)
+		if err != nil {
+			continue
+		}
+		// The UCI decoder does not check that the move is legal.
+		for _, valid := range pos.ValidMoves() {
+			if valid.S1() == m.S1() && valid.S2() == m.S2() && valid.Promo() == m.Promo() {
+				return chess.UCINotation{}.Encode(pos, valid), nil
+			}
+		}
+	}
+
+	return "", ErrIllegalMove
+}
+
+// WithNotation returns a copy of the info with its moves encoded using the
+// given notation.
+func (info GameInfo) WithNotation(n Notation) (*GameInfo, error) {
+	if n == NotationAuto || n == NotationUCI {
+		return &info, nil
+	}
+
+	game, err := info.Replay()
+	if err != nil {
+		return nil, err
+	}
+
+	positions, played := game.Positions(), game.Moves()
+	moves := make([]string, len(played))
+	for i, m := range played {
+		moves[i] = n.Encode(positions[i], m)
+	}
+	info.Moves = moves
+
+	if info.ValidMoves != nil {
+		pos := game.Position()
+		valid := make([]string, 0, len(info.ValidMoves))
+		for _, m := range pos.ValidMoves() {
+			valid = append(valid, n.Encode(pos, m))
+		}
+		info.ValidMoves = valid
+	}
+
+	return &info, nil
+}
+
+// Replay plays the moves of the game from its initial position.
+func (info GameInfo) Replay() (*chess.Game, error) {
+	opts := []func(*chess.Game){chess.UseNotation(chess.UCINotation{})}
+	if info.StartFEN != "" {
+		fen, err := chess.FEN(info.StartFEN)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, fen)
+	}
+	game := chess.NewGame(opts...)
+
+	for _, m := range info.Moves {
+		if err := game.MoveStr(m); err != nil {
+			return nil, fmt.Errorf("error replaying move %q: %v", m, err)
+		}
+	}
+
+	return game, nil
+}
+
+// Position returns the current position of the game.
+func (info GameInfo) Position() (*chess.Position, error) {
+	fen, err := chess.FEN(info.FEN)
+	if err != nil {
+		return nil, err
+	}
+	return chess.NewGame(fen).Position(), nil
+}
@@ -0,0 +1,72 @@
+package game_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/notnil/chess"
+
+	"github.com/sevein/chesstempo/game"
+)
+
+func TestDecodeMove(t *testing.T) {
+	t.Parallel()
+
+	fen, err := chess.FEN("3rk2r/4P3/8/8/8/8/8/4K2R w Kk - 0 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos := chess.NewGame(fen).Position()
+
+	tests := []struct {
+		move     string
+		notation game.Notation
+		want     string
+	}{
+		{"e7d8q", game.NotationAuto, "e7d8q"},
+		{"exd8=Q+", game.NotationAuto, "e7d8q"},
+		{"e7xd8=N", game.NotationAuto, "e7d8n"},
+		{"O-O", game.NotationAuto, "e1g1"},
+		{"0-0", game.NotationSAN, "e1g1"},
+		{"Rh1h5", game.NotationLAN, "h1h5"},
+		{"E1F1", game.NotationUCI, "e1f1"},
+		{"Kf1", game.NotationUCI, ""},
+		{"e1e3", game.NotationAuto, ""},
+		{"Nf3", game.NotationAuto, ""},
+	}
+	for _, tc := range tests {
+		got, err := game.DecodeMove(pos, tc.move, tc.notation)
+		if tc.want == "" {
+			if err != game.ErrIllegalMove {
+				t.Errorf("%s (%q): got %q, want illegal move", tc.move, tc.notation, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("%s (%q): got %q (%v), want %q", tc.move, tc.notation, got, err, tc.want)
+		}
+	}
+}
+
+func TestGameInfoWithNotation(t *testing.T) {
+	t.Parallel()
+
+	info := game.GameInfo{
+		Moves:      []string{"e2e4", "e7e5", "g1f3"},
+		ValidMoves: []string{"b8c6"},
+	}
+
+	got, err := info.WithNotation(game.NotationSAN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"e4", "e5", "Nf3"}; !reflect.DeepEqual(got.Moves, want) {
+		t.Errorf("moves: got %v, want %v", got.Moves, want)
+	}
+	if len(got.ValidMoves) != 29 || got.ValidMoves[11] != "Nc6" {
+		t.Errorf("valid moves: got %v", got.ValidMoves)
+	}
+	if info.Moves[0] != "e2e4" {
+		t.Errorf("original info was modified: %v", info.Moves)
+	}
+}
@@ -0,0 +1,105 @@
+package game
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+// Recipient of the notifications of a game.
+type Recipient struct {
+	Email   string `json:"email,omitempty"`
+	Webhook string `json:"webhook,omitempty"`
+}
+
+// NotificationKind describes why a notification is sent.
+type NotificationKind string
+
+const (
+	YourTurn NotificationKind = "turn"
+	Reminder NotificationKind = "reminder"
+)
+
+// Notification sent to the user of a correspondence game.
+type Notification struct {
+	GameID   string           `json:"gameId"`
+	Kind     NotificationKind `json:"kind"`
+	To       Recipient        `json:"to"`
+	Deadline time.Time        `json:"deadline"`
+	FEN      string           `json:"fen"`
+}
+
+func (n Notification) Subject() string {
+	switch n.Kind {
+	case Reminder:
+		return fmt.Sprintf("Reminder: your move in game %s", n.GameID)
+	default:
+		return fmt.Sprintf("Your move in game %s", n.GameID)
+	}
+}
+
+func (n Notification) Body() string {
+	return fmt.Sprintf("It is your turn in game %s.\n\nPosition: %s\nDeadline: %s\n",
+		n.GameID, n.FEN, n.Deadline.UTC().Format(time.RFC1123))
+}
+
+// Notifier delivers notifications, e.g. by email.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+const NotifyActivityName = "notify"
+
+// NotifyActivity delivers notifications using every configured notifier.
+type NotifyActivity struct {
+	notifiers []Notifier
+}
+
+func NewNotifyActivity(notifiers ...Notifier) *NotifyActivity {
+	return &NotifyActivity{notifiers}
+}
+
+// Execute tries every notifier even if some of them fail. Notifications are
+// delivered at least once, i.e. a retry may deliver them again.
+func (a *NotifyActivity) Execute(ctx context.Context, n Notification) error {
+	var errs []string
+	for _, notifier := range a.notifiers {
+		if err := notifier.Notify(ctx, n); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("notification failed: %s", strings.Join(errs, "; "))
+	}
+	activity.GetLogger(ctx).Info("Notification sent", "kind", n.Kind)
+
+	return nil
+}
+
+// notify sends a notification without blocking the game. Failures are logged
+// but never end the game.
+func notify(ctx workflow.Context, n Notification) {
+	if n.To == (Recipient{}) {
+		return
+	}
+
+	opts := workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: time.Second * 30,
+		RetryPolicy: &temporal.RetryPolicy{
+			MaximumAttempts: 5,
+		},
+	})
+	future := workflow.ExecuteActivity(opts, NotifyActivityName, n)
+
+	workflow.Go(ctx, func(ctx workflow.Context) {
+		if err := future.Get(ctx, nil); err != nil {
+			workflow.GetLogger(ctx).Warn("Notification failed", "kind", n.Kind, "err", err)
+		}
+	})
+}
@@ -0,0 +1,389 @@
+package game
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/notnil/chess"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/worker"
+)
+
+var (
+	ErrUnknownRequest = errors.New("unknown move request")
+	ErrBotToken       = errors.New("invalid bot token")
+	ErrTooManyBots    = errors.New("too many bots")
+)
+
+const remoteBotQueuePrefix = "bot-"
+
+// RemoteBotQueue returns the task queue of the remote bot with the given name.
+func RemoteBotQueue(name string) string {
+	return remoteBotQueuePrefix + name
+}
+
+func isRemoteBotQueue(queue string) bool {
+	return strings.HasPrefix(queue, remoteBotQueuePrefix)
+}
+
+// remoteBotTimeout is the time given to remote bots to move, longer than the
+// time of the engines since positions and moves go over the network.
+const remoteBotTimeout = time.Second * 30
+
+// DefaultMaxRemoteBots is the number of remote bots that can be registered.
+const DefaultMaxRemoteBots = 32
+
+// remoteBotSeen is the time a remote bot is considered connected after it last
+// asked for a position.
+const remoteBotSeen = time.Minute
+
+// RemoteBots are the external programs registered as bots, e.g. homegrown
+// engines. Each bot is served by an activity worker that polls the task queue
+// of the bot and relays the positions of the machine's turn to the program.
+type RemoteBots struct {
+	client client.Client
+
+	// WorkerStopTimeout is given to the searches in progress when a bot is
+	// unregistered.
+	WorkerStopTimeout time.Duration
+
+	// MaxBots is the number of bots that can be registered.
+	MaxBots int
+
+	// Path is the file where the registrations are kept across restarts,
+	// they are only kept in memory when empty.
+	Path string
+
+	mu   sync.Mutex
+	bots map[string]*RemoteBot
+}
+
+func NewRemoteBots(c client.Client) *RemoteBots {
+	return &RemoteBots{
+		client:            c,
+		WorkerStopTimeout: time.Second * 10,
+		MaxBots:           DefaultMaxRemoteBots,
+		bots:              map[string]*RemoteBot{},
+	}
+}
+
+// Load registers the bots kept in Path, if any.
+func (r *RemoteBots) Load() error {
+	if r.Path == "" {
+		return nil
+	}
+	blob, err := os.ReadFile(r.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	hashes := map[string]string{}
+	if err := json.Unmarshal(blob, &hashes); err != nil {
+		return fmt.Errorf("error decoding %s: %v", r.Path, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for name, hash := range hashes {
+		bot, err := r.start(name, hash)
+		if err != nil {
+			return err
+		}
+		r.bots[name] = bot
+	}
+	return nil
+}
+
+// Register returns the bot with the given name, starting its worker if it was
+// not registered yet. New bots are given a token, which is returned only once
+// and is required to register the bot again or to play as it.
+func (r *RemoteBots) Register(name, token string) (bot *RemoteBot, newToken string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if bot, ok := r.bots[name]; ok {
+		if !bot.Authorize(token) {
+			return nil, "", ErrBotToken
+		}
+		return bot, "", nil
+	}
+	if len(r.bots) >= r.MaxBots {
+		return nil, "", ErrTooManyBots
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	newToken = hex.EncodeToString(secret)
+	if bot, err = r.start(name, hashToken(newToken)); err != nil {
+		return nil, "", err
+	}
+	r.bots[name] = bot
+	if err := r.save(); err != nil {
+		delete(r.bots, name)
+		bot.worker.Stop()
+		return nil, "", err
+	}
+
+	return bot, newToken, nil
+}
+
+// start starts the worker of the bot.
+func (r *RemoteBots) start(name, hash string) (*RemoteBot, error) {
+	bot := &RemoteBot{
+		Name:      name,
+		tokenHash: hash,
+		requests:  make(chan *MoveRequest),
+		pending:   map[string]*MoveRequest{},
+	}
+	w := worker.New(r.client, RemoteBotQueue(name), worker.Options{
+		DisableWorkflowWorker: true,
+		WorkerStopTimeout:     r.WorkerStopTimeout,
+	})
+	w.RegisterActivityWithOptions(bot.Execute, activity.RegisterOptions{Name: BotActivityName})
+	if err := w.Start(); err != nil {
+		return nil, fmt.Errorf("error starting worker of bot %q: %v", name, err)
+	}
+	bot.worker = w
+
+	return bot, nil
+}
+
+// save writes the registrations to Path. Only the hashes of the tokens are
+// kept.
+func (r *RemoteBots) save() error {
+	if r.Path == "" {
+		return nil
+	}
+	hashes := make(map[string]string, len(r.bots))
+	for name, bot := range r.bots {
+		hashes[name] = bot.tokenHash
+	}
+	blob, err := json.Marshal(hashes)
+	if err != nil {
+		return err
+	}
+	tmp := r.Path + ".tmp"
+	if err := os.WriteFile(tmp, blob, 0o600); err != nil {
+		return fmt.Errorf("error saving bots: %v", err)
+	}
+	if err := os.Rename(tmp, r.Path); err != nil {
+		return fmt.Errorf("error saving bots: %v", err)
+	}
+	return nil
+}
+
+// Bot returns the registered bot with the given name.
+func (r *RemoteBots) Bot(name string) (*RemoteBot, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	bot, ok := r.bots[name]
+	return bot, ok
+}
+
+// Bots returns the registered bots sorted by name.
+func (r *RemoteBots) Bots() []*RemoteBot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ret := make([]*RemoteBot, 0, len(r.bots))
+	for _, bot := range r.bots {
+		ret = append(ret, bot)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// Unregister stops the worker of the bot, given its token, and forgets it.
+// Games that request it afterwards wait until it is registered again.
+func (r *RemoteBots) Unregister(name, token string) (bool, error) {
+	r.mu.Lock()
+	bot, ok := r.bots[name]
+	if !ok {
+		r.mu.Unlock()
+		return false, nil
+	}
+	if !bot.Authorize(token) {
+		r.mu.Unlock()
+		return true, ErrBotToken
+	}
+	delete(r.bots, name)
+	err := r.save()
+	r.mu.Unlock()
+
+	bot.worker.Stop()
+	return true, err
+}
+
+// Close stops the workers of the bots, which are still registered in Path.
+func (r *RemoteBots) Close() {
+	r.mu.Lock()
+	bots := r.bots
+	r.bots = map[string]*RemoteBot{}
+	r.mu.Unlock()
+
+	for _, bot := range bots {
+		bot.worker.Stop()
+	}
+}
+
+// MoveRequest is a position where the remote bot is expected to move before
+// the deadline, otherwise the position is sent again.
+type MoveRequest struct {
+	ID       string    `json:"id"`
+	GameID   string    `json:"gameId"`
+	FEN      string    `json:"fen"`
+	Deadline time.Time `json:"deadline"`
+
+	reply chan string
+}
+
+// RemoteBot is an external program that plays as the machine. Programs take
+// the positions with Next and send their moves with Reply.
+type RemoteBot struct {
+	Name string
+
+	tokenHash string
+	worker    worker.Worker
+	requests  chan *MoveRequest
+
+	mu      sync.Mutex
+	pending map[string]*MoveRequest
+	waiting int       // Calls to Next in progress.
+	seen    time.Time // Last call to Next.
+}
+
+// Authorize reports whether the token is the token of the bot.
+func (b *RemoteBot) Authorize(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(b.tokenHash)) == 1
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Execute is the bot activity of the remote bot, it waits until the program
+// replies with its move or the activity times out.
+func (b *RemoteBot) Execute(ctx context.Context, fen string) (string, error) {
+	if _, err := chess.FEN(fen); err != nil {
+		return "", err
+	}
+
+	info := activity.GetInfo(ctx)
+	req := &MoveRequest{
+		ID:       uuid.New().String(),
+		GameID:   info.WorkflowExecution.ID,
+		FEN:      fen,
+		Deadline: info.Deadline,
+		reply:    make(chan string, 1),
+	}
+	defer func() {
+		b.mu.Lock()
+		delete(b.pending, req.ID)
+		b.mu.Unlock()
+	}()
+
+	defer heartbeat(ctx, nil)()
+	stop := activity.GetWorkerStopChannel(ctx)
+
+	select {
+	case b.requests <- req:
+	case <-ctx.Done():
+		return "", fmt.Errorf("bot %q did not ask for the position: %v", b.Name, ctx.Err())
+	case <-stop:
+		return "", fmt.Errorf("bot %q was unregistered", b.Name)
+	}
+
+	select {
+	case move := <-req.reply:
+		activity.GetLogger(ctx).Info("Generated move", "move", move, "fen", fen, "bot", b.Name)
+		return move, nil
+	case <-ctx.Done():
+		return "", fmt.Errorf("bot %q did not move: %v", b.Name, ctx.Err())
+	case <-stop:
+		return "", fmt.Errorf("bot %q was unregistered", b.Name)
+	}
+}
+
+// Next waits for the next position where the bot has to move.
+func (b *RemoteBot) Next(ctx context.Context) (*MoveRequest, error) {
+	b.mu.Lock()
+	b.waiting++
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		b.waiting--
+		b.seen = time.Now()
+		b.mu.Unlock()
+	}()
+
+	select {
+	case req := <-b.requests:
+		b.mu.Lock()
+		b.pending[req.ID] = req
+		b.mu.Unlock()
+		return req, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Reply sends the move of the bot in UCI notation. Illegal moves are rejected
+// so the bot can try again before the deadline.
+func (b *RemoteBot) Reply(id, move string) error {
+	b.mu.Lock()
+	req, ok := b.pending[id]
+	b.mu.Unlock()
+	if !ok {
+		return ErrUnknownRequest
+	}
+
+	fen, err := chess.FEN(req.FEN)
+	if err != nil {
+		return err
+	}
+	uci, err := DecodeMove(chess.NewGame(fen).Position(), move, NotationUCI)
+	if err != nil {
+		return err
+	}
+
+	// Only the first of concurrent replies is taken.
+	b.mu.Lock()
+	_, ok = b.pending[id]
+	delete(b.pending, id)
+	b.mu.Unlock()
+	if !ok {
+		return ErrUnknownRequest
+	}
+
+	req.reply <- uci
+	return nil
+}
+
+// Connected reports whether the program is waiting for positions or did so
+// recently.
+func (b *RemoteBot) Connected() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.waiting > 0 || time.Since(b.seen) < remoteBotSeen
+}
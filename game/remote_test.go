@@ -0,0 +1,70 @@
+package game_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr"
+
+	"github.com/sevein/chesstempo/game"
+	"github.com/sevein/chesstempo/temporal"
+)
+
+func TestRemoteBots(t *testing.T) {
+	tc := temporal.New()
+	tc.Namespace = "default"
+	tc.Embedded = true
+	tc.Ephemeral = true
+	if err := tc.Create(logr.Discard()); err != nil {
+		t.Fatal(err)
+	}
+	defer tc.Close()
+
+	path := filepath.Join(t.TempDir(), "bots.json")
+	open := func() *game.RemoteBots {
+		bots := game.NewRemoteBots(tc.Client)
+		bots.Path = path
+		bots.MaxBots = 1
+		bots.WorkerStopTimeout = 0
+		if err := bots.Load(); err != nil {
+			t.Fatal(err)
+		}
+		return bots
+	}
+
+	bots := open()
+	_, token, err := bots.Register("mybot", "")
+	if err != nil || token == "" {
+		t.Fatalf("register: got token %q and %v", token, err)
+	}
+	if _, _, err := bots.Register("mybot", ""); !errors.Is(err, game.ErrBotToken) {
+		t.Errorf("register without token: got %v, want %v", err, game.ErrBotToken)
+	}
+	if _, again, err := bots.Register("mybot", token); err != nil || again != "" {
+		t.Errorf("register with token: got token %q and %v", again, err)
+	}
+	if _, _, err := bots.Register("other", ""); !errors.Is(err, game.ErrTooManyBots) {
+		t.Errorf("register over the limit: got %v, want %v", err, game.ErrTooManyBots)
+	}
+	bots.Close()
+
+	// Registrations are kept across restarts.
+	bots = open()
+	if bot, ok := bots.Bot("mybot"); !ok || !bot.Authorize(token) {
+		t.Fatal("bot was not loaded")
+	}
+	if ok, err := bots.Unregister("mybot", "secret"); !ok || !errors.Is(err, game.ErrBotToken) {
+		t.Errorf("unregister with another token: got %v and %v", ok, err)
+	}
+	if ok, err := bots.Unregister("mybot", token); !ok || err != nil {
+		t.Errorf("unregister: got %v and %v", ok, err)
+	}
+	bots.Close()
+
+	bots = open()
+	defer bots.Close()
+	if _, ok := bots.Bot("mybot"); ok {
+		t.Error("unregistered bot was loaded")
+	}
+}
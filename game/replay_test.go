@@ -0,0 +1,83 @@
+package game_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"go.temporal.io/sdk/worker"
+
+	"github.com/sevein/chesstempo/game"
+)
+
+// TestReplay runs the histories recorded in testdata through the current
+// GameWorkflow to detect nondeterministic changes before they are deployed.
+//
+// New fixtures can be recorded from a running server with:
+//
+//	tctl workflow show --workflow_id ID --output_filename game/testdata/NAME.json
+func TestReplay(t *testing.T) {
+	t.Parallel()
+
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no histories found in testdata")
+	}
+
+	for _, fixture := range fixtures {
+		fixture := fixture
+		t.Run(filepath.Base(fixture), func(t *testing.T) {
+			t.Parallel()
+
+			lastEventID := mustReadLastEventID(t, fixture)
+
+			replayer := worker.NewWorkflowReplayer()
+			replayer.RegisterWorkflow(game.GameWorkflow)
+
+			if err := replayer.ReplayPartialWorkflowHistoryFromJSONFile(nil, fixture, lastEventID); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// mustReadLastEventID returns the identifier of the last event in the history
+// that did not close the workflow. The replayer compares the result of the
+// workflow byte by byte, which would break the fixtures every time that
+// GameInfo or GameWorkflowParams gain new fields.
+func mustReadLastEventID(tb testing.TB, path string) int64 {
+	tb.Helper()
+
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	history := struct {
+		Events []struct {
+			EventID   string `json:"eventId"`
+			EventType string `json:"eventType"`
+		} `json:"events"`
+	}{}
+	if err := json.Unmarshal(blob, &history); err != nil {
+		tb.Fatal(err)
+	}
+
+	var lastEventID int64
+	for _, event := range history.Events {
+		switch event.EventType {
+		case "WorkflowExecutionCompleted", "WorkflowExecutionContinuedAsNew":
+			continue
+		}
+		if lastEventID, err = strconv.ParseInt(event.EventID, 10, 64); err != nil {
+			tb.Fatal(err)
+		}
+	}
+
+	return lastEventID
+}
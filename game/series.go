@@ -0,0 +1,59 @@
+package game
+
+import (
+	"github.com/notnil/chess"
+)
+
+// ParentIDSearchAttribute is the custom search attribute that links a rematch
+// to the game that preceded it. It must be registered in the namespace.
+const ParentIDSearchAttribute = "ChessTempoParentID"
+
+// Series is the running score of a sequence of games linked by rematches.
+type Series struct {
+	Games   []string `json:"games"`   // Finished games, oldest first.
+	User    float64  `json:"user"`    // Points earned by the user.
+	Machine float64  `json:"machine"` // Points earned by the machine.
+}
+
+// Add returns a copy of the series that includes the result of a finished
+// game. Wins are worth one point and draws half a point to each side.
+func (s *Series) Add(id string, outcome chess.Outcome, c Color) *Series {
+	next := Series{}
+	if s != nil {
+		next = *s
+		next.Games = append([]string{}, s.Games...)
+	}
+	next.Games = append(next.Games, id)
+
+	switch outcome {
+	case chess.Draw:
+		next.User += 0.5
+		next.Machine += 0.5
+	case chess.WhiteWon, chess.BlackWon:
+		if (outcome == chess.WhiteWon) == (c == White) {
+			next.User++
+		} else {
+			next.Machine++
+		}
+	}
+
+	return &next
+}
+
+// Rematch returns the parameters of a new game linked to a finished one, with
+// colors swapped and the series score updated with its result. Correspondence
+// settings are not carried over, the server defaults apply instead.
+func Rematch(id string, info *GameInfo) GameWorkflowParams {
+	color := White
+	if info.Color == White {
+		color = Black
+	}
+
+	return GameWorkflowParams{
+		Color:    color,
+		Mode:     info.Mode,
+		Engine:   info.Engine,
+		ParentID: id,
+		Series:   info.Series.Add(id, info.Outcome, info.Color),
+	}
+}
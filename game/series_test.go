@@ -0,0 +1,90 @@
+package game_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/notnil/chess"
+
+	"github.com/sevein/chesstempo/game"
+)
+
+func TestSeriesAdd(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		series  *game.Series
+		outcome chess.Outcome
+		color   game.Color
+		want    game.Series
+	}{
+		{"user wins as white", nil, chess.WhiteWon, game.White, game.Series{Games: []string{"g2"}, User: 1}},
+		{"user wins as black", nil, chess.BlackWon, game.Black, game.Series{Games: []string{"g2"}, User: 1}},
+		{"machine wins against white", nil, chess.BlackWon, game.White, game.Series{Games: []string{"g2"}, Machine: 1}},
+		{"machine wins against black", nil, chess.WhiteWon, game.Black, game.Series{Games: []string{"g2"}, Machine: 1}},
+		{"draw", nil, chess.Draw, game.White, game.Series{Games: []string{"g2"}, User: 0.5, Machine: 0.5}},
+		{"no outcome", nil, chess.NoOutcome, game.White, game.Series{Games: []string{"g2"}}},
+		{
+			"running score",
+			&game.Series{Games: []string{"g1"}, User: 0.5, Machine: 0.5},
+			chess.WhiteWon, game.White,
+			game.Series{Games: []string{"g1", "g2"}, User: 1.5, Machine: 0.5},
+		},
+	}
+	for _, tc := range tests {
+		var before *game.Series
+		if tc.series != nil {
+			copied := *tc.series
+			copied.Games = append([]string{}, tc.series.Games...)
+			before = &copied
+		}
+
+		got := tc.series.Add("g2", tc.outcome, tc.color)
+		if !reflect.DeepEqual(*got, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, *got, tc.want)
+		}
+		if !reflect.DeepEqual(tc.series, before) {
+			t.Errorf("%s: series was modified: %+v", tc.name, tc.series)
+		}
+	}
+}
+
+func TestRematch(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		info game.GameInfo
+		want game.GameWorkflowParams
+	}{
+		{
+			"colors are swapped",
+			game.GameInfo{Color: game.White, Outcome: chess.BlackWon},
+			game.GameWorkflowParams{Color: game.Black, ParentID: "g1", Series: &game.Series{Games: []string{"g1"}, Machine: 1}},
+		},
+		{
+			"mode and engine are carried over",
+			game.GameInfo{
+				Color:   game.Black,
+				Outcome: chess.Draw,
+				Mode:    game.Correspondence,
+				Engine:  "strong",
+				Series:  &game.Series{Games: []string{"g0"}, User: 1},
+			},
+			game.GameWorkflowParams{
+				Color:    game.White,
+				Mode:     game.Correspondence,
+				Engine:   "strong",
+				ParentID: "g1",
+				Series:   &game.Series{Games: []string{"g0", "g1"}, User: 1.5, Machine: 0.5},
+			},
+		},
+	}
+	for _, tc := range tests {
+		info := tc.info
+		if got := game.Rematch("g1", &info); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package game
+
+// Change identifiers used with workflow.GetVersion. Every change that alters
+// the commands issued by GameWorkflow must be guarded by a new version so the
+// games started by older workers can still be replayed after a deploy, and a
+// history recorded with the new version should be added to testdata.
+const (
+	// turnTimersChangeID guards the timers armed during the turn of the
+	// user (idle timeouts and correspondence deadlines), the notifications
+	// and continuing as new.
+	turnTimersChangeID = "turn-timers"
+
+	// cancelSearchChangeID guards the heartbeat timeout of the bot activity
+	// and its cancellation when the game ends during the machine's turn.
+	cancelSearchChangeID = "cancel-search"
+
+	// legacyWaitChangeID guards waiting for a move or the end of the game in
+	// games started before turnTimersChangeID, which passed the turn to the
+	// machine on any signal, e.g. a vacation or a draw offer. It is checked
+	// when such a signal arrives so games in flight pick it up.
+	legacyWaitChangeID = "legacy-wait"
+
+	// engineWaitChangeID guards waiting for the engine when the bot activity
+	// times out, which used to fail the game. It is checked when the activity
+	// times out.
+	engineWaitChangeID = "engine-wait"
+)
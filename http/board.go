@@ -0,0 +1,269 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/notnil/chess"
+
+	"github.com/sevein/chesstempo/game"
+	"github.com/sevein/chesstempo/render"
+)
+
+// minBoardSize is the smallest size of the boards, in pixels.
+const minBoardSize = 64
+
+const (
+	// maxReplaySize bounds the size of the replays, which have a frame per
+	// move.
+	maxReplaySize = 720
+
+	// maxReplayPixels bounds the pixels of all the frames of a replay, e.g.
+	// 400 frames of the default size.
+	maxReplayPixels = 400 * render.DefaultSize * render.DefaultSize
+
+	// maxReplays is the number of replays rendered at the same time.
+	maxReplays = 2
+
+	// replayCacheSize is the memory taken by the replays of finished games.
+	replayCacheSize = 32 << 20
+)
+
+// handleGameBoard renders the current position of a game, seen from the side
+// of the user unless the orientation is given.
+func (s *Server) handleGameBoard(w http.ResponseWriter, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	workflowID := vars["id"]
+
+	info, err := s.readGame(ctx, workflowID)
+	if err != nil {
+		return err
+	}
+	g, err := info.Replay()
+	if err != nil {
+		return err
+	}
+
+	opts, highlight, err := boardOptions(r, info.Color == game.Black)
+	if err != nil {
+		return err
+	}
+	if moves := g.Moves(); highlight && len(moves) > 0 {
+		opts.Highlight = render.MoveSquares(moves[len(moves)-1])
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	return writeBoard(w, g.Position(), vars["format"], opts)
+}
+
+// handleBoard renders the position given by the query, which is enough to
+// cache the image.
+func (s *Server) handleBoard(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+
+	fen, err := chess.FEN(query.Get("fen"))
+	if err != nil {
+		return badRequest(ErrInvalidArgument, "Position is invalid.")
+	}
+
+	opts, highlight, err := boardOptions(r, false)
+	if err != nil {
+		return err
+	}
+	if v := query.Get("lastMove"); v != "" {
+		from, to, ok := parseSquares(v)
+		if !ok {
+			return badRequest(ErrInvalidArgument, "Last move is invalid.")
+		}
+		if highlight {
+			opts.Highlight = []chess.Square{from, to}
+		}
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	return writeBoard(w, chess.NewGame(fen).Position(), mux.Vars(r)["format"], opts)
+}
+
+// handleGameReplay renders the moves of a game as an animated GIF.
+func (s *Server) handleGameReplay(w http.ResponseWriter, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	workflowID := vars["id"]
+	query := r.URL.Query()
+
+	// Finished games do not change.
+	key := workflowID + "?" + query.Encode()
+	if blob, ok := s.replayCache.Get(key); ok {
+		return writeReplay(w, blob, true)
+	}
+
+	opts := render.ReplayOptions{Captions: true}
+	if v := query.Get("delay"); v != "" {
+		delay, err := strconv.Atoi(v)
+		if err != nil || delay < 100 || delay > 10000 {
+			return badRequest(ErrInvalidArgument, "Delay must be between 100 and 10000 milliseconds.")
+		}
+		opts.Delay = time.Duration(delay) * time.Millisecond
+	}
+	if v := query.Get("captions"); v != "" {
+		var err error
+		if opts.Captions, err = strconv.ParseBool(v); err != nil {
+			return badRequest(ErrInvalidArgument, "Parameter captions is not a boolean.")
+		}
+	}
+
+	info, err := s.readGame(ctx, workflowID)
+	if err != nil {
+		return err
+	}
+	g, err := info.Replay()
+	if err != nil {
+		return err
+	}
+
+	if opts.Board, opts.LastMove, err = boardOptions(r, info.Color == game.Black); err != nil {
+		return err
+	}
+	if opts.Board.Size > maxReplaySize {
+		return badRequest(ErrInvalidArgument, fmt.Sprintf("Size of replays must be between %d and %d pixels.", minBoardSize, maxReplaySize))
+	}
+	opts.Board.Arrows = nil
+	size := opts.Board.Size
+	if size == 0 {
+		size = render.DefaultSize
+	}
+	if frames := len(g.Positions()); frames*size*size > maxReplayPixels {
+		return badRequest(ErrInvalidArgument, fmt.Sprintf("Replay of %d moves is too large for the size, use a smaller size.", frames-1))
+	}
+
+	finished := info.Outcome != chess.NoOutcome
+	if finished {
+		opts.Result = string(info.Outcome)
+	}
+
+	select {
+	case s.replays <- struct{}{}:
+		defer func() { <-s.replays }()
+	case <-r.Context().Done():
+		return r.Context().Err()
+	}
+
+	// Rendered first so errors are still reported as JSON.
+	b := &bytes.Buffer{}
+	if err := render.GIF(b, g, opts); err != nil {
+		return err
+	}
+	if finished {
+		s.replayCache.Add(key, b.Bytes())
+	}
+
+	return writeReplay(w, b.Bytes(), finished)
+}
+
+func writeReplay(w http.ResponseWriter, blob []byte, finished bool) error {
+	if finished {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	} else {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+	w.Header().Set("Content-Type", "image/gif")
+	_, err := w.Write(blob)
+	return err
+}
+
+// boardOptions reads the rendering options from the query. The squares of the
+// last move are left to the caller, highlight tells whether they are wanted.
+func boardOptions(r *http.Request, flip bool) (opts render.Options, highlight bool, err error) {
+	query := r.URL.Query()
+	opts = render.Options{Flip: flip, Coordinates: true}
+	highlight = true
+
+	switch query.Get("orientation") {
+	case "":
+	case "white":
+		opts.Flip = false
+	case "black":
+		opts.Flip = true
+	default:
+		return opts, false, badRequest(ErrInvalidArgument, "Orientation is unknown.")
+	}
+
+	for name, value := range map[string]*bool{"coordinates": &opts.Coordinates, "highlight": &highlight} {
+		if v := query.Get(name); v != "" {
+			if *value, err = strconv.ParseBool(v); err != nil {
+				return opts, false, badRequest(ErrInvalidArgument, fmt.Sprintf("Parameter %s is not a boolean.", name))
+			}
+		}
+	}
+	opts.Check = highlight
+
+	if v := query.Get("size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < minBoardSize || size > render.MaxSize {
+			return opts, false, badRequest(ErrInvalidArgument, fmt.Sprintf("Size must be between %d and %d pixels.", minBoardSize, render.MaxSize))
+		}
+		opts.Size = size
+	}
+
+	if v := query.Get("arrows"); v != "" {
+		for _, arrow := range strings.Split(v, ",") {
+			from, to, ok := parseSquares(arrow)
+			if !ok {
+				return opts, false, badRequest(ErrInvalidArgument, fmt.Sprintf("Arrow %q is invalid.", arrow))
+			}
+			opts.Arrows = append(opts.Arrows, render.Arrow{From: from, To: to})
+		}
+	}
+
+	return opts, highlight, nil
+}
+
+var squares = func() map[string]chess.Square {
+	ret := make(map[string]chess.Square, 64)
+	for i := 0; i < 64; i++ {
+		ret[chess.Square(i).String()] = chess.Square(i)
+	}
+	return ret
+}()
+
+// parseSquares parses a pair of squares written like a move in UCI notation,
+// e.g. "e2e4".
+func parseSquares(s string) (from, to chess.Square, ok bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) != 4 {
+		return chess.NoSquare, chess.NoSquare, false
+	}
+	from, ok1 := squares[s[:2]]
+	to, ok2 := squares[s[2:]]
+	return from, to, ok1 && ok2
+}
+
+// writeBoard writes the image of the board in the given format.
+func writeBoard(w http.ResponseWriter, pos *chess.Position, format string, opts render.Options) error {
+	switch format {
+	case "svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		return render.SVG(w, pos, opts)
+	case "png":
+		// Rasterize first so errors are still reported as JSON.
+		img, err := render.Image(pos, opts)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", "image/png")
+		return png.Encode(w, img)
+	}
+	return &ResponseError{Status: http.StatusNotFound, Code: ErrNotFound, Reason: "Image format is unknown."}
+}
@@ -0,0 +1,70 @@
+package http_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	chesshttp "github.com/sevein/chesstempo/http"
+)
+
+func TestBoardHandlers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		target       string
+		status       int
+		code         string
+		contentType  string
+		cacheControl string
+	}{
+		{"svg", "/api/games/live/board.svg", http.StatusOK, "", "image/svg+xml", "no-store"},
+		{"png", "/api/games/over/board.png?orientation=black&size=64", http.StatusOK, "", "image/png", "no-store"},
+		{"unknown game", "/api/games/unknown/board.svg", http.StatusNotFound, chesshttp.ErrNotFound, "", ""},
+		{"small size", "/api/games/live/board.svg?size=10", http.StatusBadRequest, "", "", ""},
+		{"unknown orientation", "/api/games/live/board.svg?orientation=up", http.StatusBadRequest, "", "", ""},
+		{"invalid arrow", "/api/games/live/board.svg?arrows=e2e4,e2", http.StatusBadRequest, chesshttp.ErrInvalidArgument, "", ""},
+		{"position", "/api/board.svg?fen=8/8/8/8/8/8/8/K6k%20w%20-%20-%200%201&lastMove=a2a1", http.StatusOK, "", "image/svg+xml", "public, max-age=86400"},
+		{"invalid position", "/api/board.svg?fen=xyz", http.StatusBadRequest, chesshttp.ErrInvalidArgument, "", ""},
+		{"replay", "/api/games/over/replay.gif?size=64", http.StatusOK, "", "image/gif", "public, max-age=86400"},
+		{"replay in progress", "/api/games/machine/replay.gif?size=64&captions=false", http.StatusOK, "", "image/gif", "no-store"},
+		{"large replay", "/api/games/over/replay.gif?size=1000", http.StatusBadRequest, "", "", ""},
+		{"short delay", "/api/games/over/replay.gif?delay=10", http.StatusBadRequest, "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(newServer(newFakeTemporal()), "GET", tt.target, "")
+
+			checkError(t, rec, tt.status, tt.code)
+			if got := rec.Header().Get("Content-Type"); tt.contentType != "" && got != tt.contentType {
+				t.Errorf("content type: got %q, want %q", got, tt.contentType)
+			}
+			if got := rec.Header().Get("Cache-Control"); tt.cacheControl != "" && got != tt.cacheControl {
+				t.Errorf("cache control: got %q, want %q", got, tt.cacheControl)
+			}
+		})
+	}
+}
+
+func TestGameReplayCache(t *testing.T) {
+	t.Parallel()
+
+	tc := newFakeTemporal()
+	s := newServer(tc)
+	first := serve(s, "GET", "/api/games/over/replay.gif?size=64", "")
+	if first.Code != http.StatusOK {
+		t.Fatalf("status: got %d (%s)", first.Code, first.Body)
+	}
+
+	// Replays of finished games are served from memory.
+	tc.err = errors.New("not cached")
+	cached := serve(s, "GET", "/api/games/over/replay.gif?size=64", "")
+	if cached.Code != http.StatusOK || cached.Body.String() != first.Body.String() {
+		t.Errorf("cached replay: got status %d and %d bytes", cached.Code, cached.Body.Len())
+	}
+
+	// The query is part of the key.
+	other := serve(s, "GET", "/api/games/over/replay.gif?size=80", "")
+	checkError(t, other, http.StatusInternalServerError, chesshttp.ErrInternal)
+}
@@ -0,0 +1,262 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	"github.com/sevein/chesstempo/game"
+)
+
+// botName is the pattern of the names of the remote bots, which are also the
+// names used by games to request them.
+var botName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// defaultBotWait is the time a long-poll request waits for a position.
+const defaultBotWait = time.Second * 30
+
+type botResponse struct {
+	Name      string `json:"name"`
+	Connected bool   `json:"connected"`
+	Token     string `json:"token,omitempty"` // Only when the bot is new.
+}
+
+func (s *Server) handleBotList(w http.ResponseWriter, r *http.Request) error {
+	ret := []botResponse{}
+	if s.Bots != nil {
+		for _, bot := range s.Bots.Bots() {
+			ret = append(ret, botResponse{Name: bot.Name, Connected: bot.Connected()})
+		}
+	}
+
+	return writeJSON(w, ret)
+}
+
+// handleBotRegister registers a remote bot, games can request it by name from
+// then on. New bots are given the token required by the other endpoints.
+// Registering the same bot again with its token is not an error, e.g. after
+// the program restarts.
+func (s *Server) handleBotRegister(w http.ResponseWriter, r *http.Request) error {
+	if s.Bots == nil {
+		return &ResponseError{Status: http.StatusServiceUnavailable, Code: ErrUnavailable, Reason: "Remote bots are disabled."}
+	}
+
+	name := mux.Vars(r)["name"]
+	if !botName.MatchString(name) {
+		return badRequest(ErrInvalidArgument, "Name must be lowercase letters, digits, dashes or underscores.")
+	}
+	if _, ok := s.EngineTaskQueues[name]; ok {
+		return &ResponseError{Status: http.StatusConflict, Code: ErrAlreadyExists, Reason: "Name is used by an engine."}
+	}
+
+	bot, token, err := s.Bots.Register(name, botToken(r))
+	if errors.Is(err, game.ErrBotToken) {
+		return botUnauthorized
+	} else if errors.Is(err, game.ErrTooManyBots) {
+		return &ResponseError{Status: http.StatusTooManyRequests, Code: ErrLimitExceeded, Reason: "Too many bots are registered."}
+	} else if err != nil {
+		return err
+	}
+	if token != "" {
+		logr.FromContextOrDiscard(r.Context()).Info("Bot registered", "bot", name)
+	}
+
+	return writeJSON(w, botResponse{Name: bot.Name, Connected: bot.Connected(), Token: token})
+}
+
+func (s *Server) handleBotUnregister(w http.ResponseWriter, r *http.Request) error {
+	name := mux.Vars(r)["name"]
+	if s.Bots == nil {
+		return botNotFound
+	}
+	ok, err := s.Bots.Unregister(name, botToken(r))
+	if !ok {
+		return botNotFound
+	} else if errors.Is(err, game.ErrBotToken) {
+		return botUnauthorized
+	} else if err != nil {
+		return err
+	}
+	logr.FromContextOrDiscard(r.Context()).Info("Bot unregistered", "bot", name)
+
+	resp := struct{ OK bool }{OK: true}
+	return writeJSON(w, resp)
+}
+
+// handleBotNext waits for the next position where the bot has to move. It
+// replies with 204 when there is none after the time given by wait.
+func (s *Server) handleBotNext(w http.ResponseWriter, r *http.Request) error {
+	bot, err := s.remoteBot(r)
+	if err != nil {
+		return err
+	}
+
+	wait := defaultBotWait
+	if v := r.URL.Query().Get("wait"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs < 1 || secs > 60 {
+			return badRequest(ErrInvalidArgument, "Wait must be between 1 and 60 seconds.")
+		}
+		wait = time.Duration(secs) * time.Second
+	}
+
+	ctx, cancel := s.longLived(r.Context())
+	defer cancel()
+	ctx, cancel = context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	req, err := bot.Next(ctx)
+	if err != nil {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	return writeJSON(w, req)
+}
+
+func (s *Server) handleBotMove(w http.ResponseWriter, r *http.Request) error {
+	bot, err := s.remoteBot(r)
+	if err != nil {
+		return err
+	}
+
+	vars := mux.Vars(r)
+	if err := botReply(bot, vars["request"], vars["move"]); err != nil {
+		return err
+	}
+
+	resp := struct{ OK bool }{OK: true}
+	return writeJSON(w, resp)
+}
+
+var botUpgrader = websocket.Upgrader{}
+
+// botMessage is a message sent to the bot over the WebSocket.
+type botMessage struct {
+	Type string `json:"type"` // position, accepted or error.
+	*game.MoveRequest
+	ID     string `json:"id,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// handleBotSocket sends the positions to the bot over a WebSocket as they
+// arrive. The bot replies with messages like {"id": "...", "move": "e2e4"}.
+func (s *Server) handleBotSocket(w http.ResponseWriter, r *http.Request) error {
+	bot, err := s.remoteBot(r)
+	if err != nil {
+		return err
+	}
+
+	conn, err := botUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return nil // The upgrader has replied already.
+	}
+	defer conn.Close()
+
+	logger := logr.FromContextOrDiscard(r.Context()).WithValues("bot", bot.Name)
+	logger.Info("Bot connected")
+	defer logger.Info("Bot disconnected")
+
+	ctx, cancel := s.longLived(r.Context())
+	defer cancel()
+
+	var mu sync.Mutex // Serializes the writes.
+	send := func(msg botMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return conn.WriteJSON(msg)
+	}
+
+	go func() {
+		defer cancel()
+		for {
+			msg := struct {
+				ID   string `json:"id"`
+				Move string `json:"move"`
+			}{}
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			reply := botMessage{Type: "accepted", ID: msg.ID}
+			if err := botReply(bot, msg.ID, msg.Move); err != nil {
+				reply = botMessage{Type: "error", ID: msg.ID, Reason: responseError(err).Reason}
+			}
+			if err := send(reply); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		req, err := bot.Next(ctx)
+		if err != nil {
+			return nil
+		}
+		if err := send(botMessage{Type: "position", MoveRequest: req, ID: req.ID}); err != nil {
+			return nil
+		}
+	}
+}
+
+var (
+	botNotFound     = &ResponseError{Status: http.StatusNotFound, Code: ErrNotFound, Reason: "Bot not found."}
+	botUnauthorized = &ResponseError{Status: http.StatusUnauthorized, Code: ErrUnauthorized, Reason: "Token of the bot is missing or invalid."}
+)
+
+// remoteBot returns the bot of the request, which must carry its token.
+func (s *Server) remoteBot(r *http.Request) (*game.RemoteBot, error) {
+	if s.Bots == nil {
+		return nil, botNotFound
+	}
+	bot, ok := s.Bots.Bot(mux.Vars(r)["name"])
+	if !ok {
+		return nil, botNotFound
+	}
+	if !bot.Authorize(botToken(r)) {
+		return nil, botUnauthorized
+	}
+	return bot, nil
+}
+
+// botToken returns the bearer token of the request.
+func botToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return auth[7:]
+	}
+	return ""
+}
+
+func botReply(bot *game.RemoteBot, id, move string) error {
+	err := bot.Reply(id, move)
+	switch {
+	case errors.Is(err, game.ErrUnknownRequest):
+		return &ResponseError{Status: http.StatusNotFound, Code: ErrNotFound, Reason: "Request not found, it may have expired."}
+	case errors.Is(err, game.ErrIllegalMove):
+		return badRequest(ErrInvalidArgument, "Move is illegal or it is not in UCI notation.")
+	}
+	return err
+}
+
+// longLived returns a context that is also done when the server is closed,
+// since the server does not wait for long-lived requests.
+func (s *Server) longLived(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-s.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
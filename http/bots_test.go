@@ -0,0 +1,124 @@
+package http_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+
+	"github.com/sevein/chesstempo/game"
+	chesshttp "github.com/sevein/chesstempo/http"
+	"github.com/sevein/chesstempo/temporal"
+)
+
+func TestBotsDisabled(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		method string
+		target string
+		status int
+		code   string
+	}{
+		{"GET", "/api/bots", http.StatusOK, ""},
+		{"PUT", "/api/bots/mybot", http.StatusServiceUnavailable, chesshttp.ErrUnavailable},
+		{"DELETE", "/api/bots/mybot", http.StatusNotFound, chesshttp.ErrNotFound},
+		{"GET", "/api/bots/mybot/next", http.StatusNotFound, chesshttp.ErrNotFound},
+		{"POST", "/api/bots/mybot/requests/1/move/e2e4", http.StatusNotFound, chesshttp.ErrNotFound},
+		{"POST", "/api/games", http.StatusBadRequest, chesshttp.ErrUnknownEngine},
+	}
+	for _, tt := range tests {
+		body := ""
+		if tt.target == "/api/games" {
+			body = `{"engine": "mybot"}`
+		}
+		rec := serve(newServer(newFakeTemporal()), tt.method, tt.target, body)
+		checkError(t, rec, tt.status, tt.code)
+	}
+}
+
+// TestBots runs the remote bots against an embedded server since their
+// workers need a real client.
+func TestBots(t *testing.T) {
+	tc := temporal.New()
+	tc.Namespace = "default"
+	tc.Embedded = true
+	tc.Ephemeral = true
+	if err := tc.Create(logr.Discard()); err != nil {
+		t.Fatal(err)
+	}
+	defer tc.Close()
+
+	s := newServer(newFakeTemporal())
+	s.Bots = game.NewRemoteBots(tc.Client)
+	s.Bots.MaxBots = 1
+	s.Bots.WorkerStopTimeout = 0
+	defer s.Bots.Close()
+
+	// Steps run in order, token is the one given to the bot.
+	var token string
+	steps := []struct {
+		name   string
+		method string
+		target string
+		auth   string // Empty, "valid" or any other token.
+		status int
+		code   string
+	}{
+		{"register with invalid name", "PUT", "/api/bots/My-Bot", "", http.StatusBadRequest, chesshttp.ErrInvalidRequest},
+		{"register with name of engine", "PUT", "/api/bots/strong", "", http.StatusConflict, chesshttp.ErrAlreadyExists},
+		{"register", "PUT", "/api/bots/mybot", "", http.StatusOK, ""},
+		{"register again without token", "PUT", "/api/bots/mybot", "", http.StatusUnauthorized, chesshttp.ErrUnauthorized},
+		{"register again", "PUT", "/api/bots/mybot", "valid", http.StatusOK, ""},
+		{"register over the limit", "PUT", "/api/bots/other", "", http.StatusTooManyRequests, chesshttp.ErrLimitExceeded},
+		{"next without token", "GET", "/api/bots/mybot/next?wait=1", "", http.StatusUnauthorized, chesshttp.ErrUnauthorized},
+		{"next with other token", "GET", "/api/bots/mybot/next?wait=1", "secret", http.StatusUnauthorized, chesshttp.ErrUnauthorized},
+		{"next", "GET", "/api/bots/mybot/next?wait=1", "valid", http.StatusNoContent, ""},
+		{"next with long wait", "GET", "/api/bots/mybot/next?wait=100", "valid", http.StatusBadRequest, chesshttp.ErrInvalidRequest},
+		{"move of unknown request", "POST", "/api/bots/mybot/requests/1/move/e2e4", "valid", http.StatusNotFound, chesshttp.ErrNotFound},
+		{"next of unknown bot", "GET", "/api/bots/other/next?wait=1", "valid", http.StatusNotFound, chesshttp.ErrNotFound},
+		{"unregister with other token", "DELETE", "/api/bots/mybot", "secret", http.StatusUnauthorized, chesshttp.ErrUnauthorized},
+		{"unregister", "DELETE", "/api/bots/mybot", "valid", http.StatusOK, ""},
+		{"unregister again", "DELETE", "/api/bots/mybot", "valid", http.StatusNotFound, chesshttp.ErrNotFound},
+	}
+	for _, step := range steps {
+		req := httptest.NewRequest(step.method, step.target, nil)
+		switch step.auth {
+		case "":
+		case "valid":
+			req.Header.Set("Authorization", "Bearer "+token)
+		default:
+			req.Header.Set("Authorization", "Bearer "+step.auth)
+		}
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+
+		if rec.Code != step.status {
+			t.Fatalf("%s: got status %d, want %d (%s)", step.name, rec.Code, step.status, rec.Body)
+		}
+		if step.code != "" {
+			checkError(t, rec, step.status, step.code)
+			continue
+		}
+		if step.method != "PUT" {
+			continue
+		}
+
+		// Only new bots are given a token.
+		bot := struct {
+			Name  string `json:"name"`
+			Token string `json:"token"`
+		}{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &bot); err != nil {
+			t.Fatal(err)
+		}
+		if bot.Name != "mybot" || (bot.Token == "") != (token != "") {
+			t.Fatalf("%s: got %s", step.name, rec.Body)
+		}
+		if token == "" {
+			token = bot.Token
+		}
+	}
+}
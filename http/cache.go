@@ -0,0 +1,62 @@
+package http
+
+import (
+	"container/list"
+	"sync"
+)
+
+// replayCache keeps the most recently used replays of finished games, which
+// do not change, up to a number of bytes.
+type replayCache struct {
+	mu      sync.Mutex
+	max     int
+	size    int
+	entries map[string]*list.Element
+	order   *list.List // Most recently used first.
+}
+
+type replayEntry struct {
+	key  string
+	blob []byte
+}
+
+func newReplayCache(max int) *replayCache {
+	return &replayCache{
+		max:     max,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+func (c *replayCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*replayEntry).blob, true
+}
+
+// Add keeps the replay unless it takes more than a quarter of the cache.
+func (c *replayCache) Add(key string, blob []byte) {
+	if len(blob) > c.max/4 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+	c.entries[key] = c.order.PushFront(&replayEntry{key: key, blob: blob})
+	c.size += len(blob)
+	for c.size > c.max {
+		entry := c.order.Remove(c.order.Back()).(*replayEntry)
+		delete(c.entries, entry.key)
+		c.size -= len(entry.blob)
+	}
+}
@@ -0,0 +1,66 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// DebugServer exposes the metrics and the health of the application.
+type DebugServer struct {
+	ln     net.Listener
+	server *http.Server
+
+	Addr            string
+	Health          *Health
+	LogLevel        http.Handler // Reports and changes the verbosity of the logger.
+	ShutdownTimeout time.Duration
+}
+
+func NewDebugServer() *DebugServer {
+	s := &DebugServer{
+		server:          &http.Server{},
+		Health:          NewHealth(),
+		ShutdownTimeout: time.Second * 10,
+	}
+
+	h := http.NewServeMux()
+	h.Handle("/metrics", promhttp.Handler())
+	h.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { s.Health.handleLive(w, r) })
+	h.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) { s.Health.handleReady(w, r) })
+	h.HandleFunc("/log/level", func(w http.ResponseWriter, r *http.Request) {
+		if s.LogLevel == nil {
+			http.NotFound(w, r)
+			return
+		}
+		s.LogLevel.ServeHTTP(w, r)
+	})
+	s.server.Handler = h
+
+	return s
+}
+
+func (s *DebugServer) Open() (err error) {
+	if s.ln, err = net.Listen("tcp", s.Addr); err != nil {
+		return err
+	}
+
+	go s.server.Serve(s.ln)
+
+	return nil
+}
+
+func (s *DebugServer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+	defer cancel()
+
+	if err := s.server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("error shutting down debug server: %v", err)
+	}
+
+	return nil
+}
@@ -1,23 +1,84 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
+
+	"github.com/go-logr/logr"
+	"go.temporal.io/api/serviceerror"
+)
+
+// Error codes of the API. Unlike the reason, they are stable and meant to be
+// checked by clients.
+const (
+	ErrInternal        = "internal"
+	ErrInvalidRequest  = "invalid_request"
+	ErrInvalidArgument = "invalid_argument"
+	ErrNotFound        = "not_found"
+	ErrAlreadyExists   = "already_exists"
+	ErrQueryRejected   = "query_rejected"
+	ErrGameInProgress  = "game_in_progress"
+	ErrGameOver        = "game_over"
+	ErrNotYourTurn     = "not_your_turn"
+	ErrUnknownEngine   = "unknown_engine"
+	ErrUnavailable     = "unavailable"
+	ErrTimeout         = "timeout"
+	ErrUnauthorized    = "unauthorized"
+	ErrLimitExceeded   = "limit_exceeded"
 )
 
+// ResponseError is the body of every error returned by the API.
 type ResponseError struct {
-	Code   int    `json:"-"`
+	Status int    `json:"status"`
+	Code   string `json:"code"`
 	Reason string `json:"reason"`
 }
 
-func (err ResponseError) Error() string {
+func (err *ResponseError) Error() string {
 	if err.Reason == "" {
-		err.Reason = "Unknown error."
+		return "Unknown error."
 	}
 	return err.Reason
 }
 
+// badRequest returns an error caused by an invalid request.
+func badRequest(code, reason string) *ResponseError {
+	return &ResponseError{Status: http.StatusBadRequest, Code: code, Reason: reason}
+}
+
+// responseError maps errors of Temporal to the error model of the API. Errors
+// that are not recognized are internal and their details are not disclosed.
+func responseError(err error) *ResponseError {
+	var (
+		er             *ResponseError
+		notFound       *serviceerror.NotFound
+		invalid        *serviceerror.InvalidArgument
+		queryFailed    *serviceerror.QueryFailed
+		alreadyStarted *serviceerror.WorkflowExecutionAlreadyStarted
+		unavailable    *serviceerror.Unavailable
+		deadline       *serviceerror.DeadlineExceeded
+	)
+	switch {
+	case errors.As(err, &er):
+		return er
+	case errors.As(err, &notFound):
+		return &ResponseError{Status: http.StatusNotFound, Code: ErrNotFound, Reason: "Game not found."}
+	case errors.As(err, &invalid):
+		return &ResponseError{Status: http.StatusBadRequest, Code: ErrInvalidArgument, Reason: invalid.Message}
+	case errors.As(err, &queryFailed):
+		return &ResponseError{Status: http.StatusConflict, Code: ErrQueryRejected, Reason: "Game cannot be queried."}
+	case errors.As(err, &alreadyStarted):
+		return &ResponseError{Status: http.StatusConflict, Code: ErrAlreadyExists, Reason: "Game already exists."}
+	case errors.As(err, &unavailable):
+		return &ResponseError{Status: http.StatusServiceUnavailable, Code: ErrUnavailable, Reason: "Service unavailable."}
+	case errors.As(err, &deadline), errors.Is(err, context.DeadlineExceeded):
+		return &ResponseError{Status: http.StatusGatewayTimeout, Code: ErrTimeout, Reason: "Request timed out."}
+	}
+	return &ResponseError{Status: http.StatusInternalServerError, Code: ErrInternal, Reason: "Internal error."}
+}
+
 type appHandler func(w http.ResponseWriter, r *http.Request) error
 
 func (h appHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -27,22 +88,32 @@ func (h appHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return // Happy path!
 	}
 
-	var er *ResponseError
-	if !errors.As(err, &er) {
-		http.Error(w, "", http.StatusBadGateway)
-		return
-	}
+	writeError(w, r, err)
+}
 
-	if ret := http.StatusText(er.Code); ret == "" {
-		er.Code = http.StatusBadGateway
+// writeError writes the error using the error model of the API.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	er := responseError(err)
+	if http.StatusText(er.Status) == "" {
+		er.Status = http.StatusInternalServerError
+	}
+	if er.Code == "" {
+		er.Code = ErrInternal
+	}
+	if er.Status >= http.StatusInternalServerError {
+		logr.FromContextOrDiscard(r.Context()).Error(err, "Request failed", "code", er.Code)
 	}
 
-	w.WriteHeader(er.Code)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(er.Status)
 
 	enc := json.NewEncoder(w)
 	enc.SetIndent("", "\t")
-	if err := enc.Encode(er); err != nil {
-		http.Error(w, "", http.StatusBadGateway)
-		return
-	}
+	_ = enc.Encode(er)
+}
+
+// writeJSON writes a successful response of the API.
+func writeJSON(w http.ResponseWriter, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(v)
 }
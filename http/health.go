@@ -0,0 +1,105 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Check reports whether a component is working.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Health runs the checks of the liveness and readiness endpoints. Liveness
+// checks cover the components of the process, e.g. the embedded Temporal
+// server, and readiness also covers its dependencies.
+type Health struct {
+	Timeout time.Duration
+
+	mu    sync.RWMutex
+	live  []namedCheck
+	ready []namedCheck
+}
+
+func NewHealth() *Health {
+	return &Health{Timeout: time.Second * 5}
+}
+
+// AddLiveness adds a check to both endpoints.
+func (h *Health) AddLiveness(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.live = append(h.live, namedCheck{name, check})
+}
+
+// AddReadiness adds a check to the readiness endpoint.
+func (h *Health) AddReadiness(name string, check Check) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.ready = append(h.ready, namedCheck{name, check})
+}
+
+func (h *Health) handleLive(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	checks := h.live
+	h.mu.RUnlock()
+
+	h.serve(w, r, checks)
+}
+
+func (h *Health) handleReady(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	checks := append(append([]namedCheck{}, h.live...), h.ready...)
+	h.mu.RUnlock()
+
+	h.serve(w, r, checks)
+}
+
+// serve runs the checks concurrently and responds with 503 if any failed.
+func (h *Health) serve(w http.ResponseWriter, r *http.Request, checks []namedCheck) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.Timeout)
+	defer cancel()
+
+	results := make([]string, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c namedCheck) {
+			defer wg.Done()
+			results[i] = "ok"
+			if err := c.check(ctx); err != nil {
+				results[i] = err.Error()
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	ret := struct {
+		Status string            `json:"status"`
+		Checks map[string]string `json:"checks"`
+	}{
+		Status: "ok",
+		Checks: map[string]string{},
+	}
+	for i, c := range checks {
+		ret.Checks[c.name] = results[i]
+		if results[i] != "ok" {
+			ret.Status = "unavailable"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if ret.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(ret)
+}
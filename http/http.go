@@ -3,20 +3,27 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net"
 	"net/http"
 	"time"
 
+	"github.com/go-logr/logr"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/notnil/chess"
 	"go.temporal.io/api/enums/v1"
 	"go.temporal.io/api/filter/v1"
+	"go.temporal.io/api/serviceerror"
 	"go.temporal.io/api/workflowservice/v1"
 	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/temporal"
 
 	"github.com/sevein/chesstempo/game"
 	"github.com/sevein/chesstempo/http/assets"
+	"github.com/sevein/chesstempo/notify"
+	"github.com/sevein/chesstempo/tracing"
 )
 
 type Server struct {
@@ -24,28 +31,105 @@ type Server struct {
 	server *http.Server
 	router *mux.Router
 
+	// Long-lived handlers, e.g. streams, return when ctx is done so they do
+	// not hold up the shutdown of the server.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Replays are rendered a few at a time and those of finished games are
+	// kept in memory.
+	replays     chan struct{}
+	replayCache *replayCache
+
+	// Queries polled by the streams of the Lichess API.
+	polls *sharedPoll
+
 	Addr           string
+	Logger         logr.Logger
 	TemporalClient client.Client
+	TaskQueue      string
+	IdlePolicy     game.IdlePolicy
+
+	// ValidateResponses logs the responses that do not conform to the
+	// specification of the API. Requests are always validated.
+	ValidateResponses bool
+
+	// Health is also served by the main router so load balancers can probe
+	// the same port that serves the traffic.
+	Health *Health
+
+	// ShutdownTimeout bounds the time given to in-flight requests to
+	// complete when the server is closed.
+	ShutdownTimeout time.Duration
+
+	// Task queues of the engine activities. Games use EngineTaskQueue unless
+	// they request one of the engines listed in EngineTaskQueues by name.
+	EngineTaskQueue  string
+	EngineTaskQueues map[string]string
+
+	// Bots are the external programs that play as the machine, requested by
+	// name like the engines. Remote bots are disabled when nil.
+	Bots *game.RemoteBots
+
+	// NotifyAllowlist restricts the recipients of the notifications of
+	// correspondence games, none are accepted by default.
+	NotifyAllowlist notify.Allowlist
+
+	// LichessLevels maps the levels of the AI of the Lichess API, 1 to 8, to
+	// the engines requested by name. Levels without an engine are played by
+	// the engine of the closest lower level, or by the default engine.
+	LichessLevels map[int]string
 }
 
 func NewServer() *Server {
 	s := &Server{
-		server: &http.Server{},
-		router: mux.NewRouter(),
+		server:          &http.Server{},
+		router:          mux.NewRouter(),
+		Logger:          logr.Discard(),
+		TaskQueue:       "queue",
+		IdlePolicy:      game.DefaultIdlePolicy,
+		EngineTaskQueue: "engine",
+		Health:          NewHealth(),
+		ShutdownTimeout: time.Second * 10,
+		replays:         make(chan struct{}, maxReplays),
+		replayCache:     newReplayCache(replayCacheSize),
+		polls:           newSharedPoll(),
 	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
 
 	router := s.router.PathPrefix("/").Subrouter()
 
+	router.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) { s.Health.handleLive(w, r) }).Methods("GET")
+	router.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) { s.Health.handleReady(w, r) }).Methods("GET")
+
 	// API namespace.
 	{
 		r := router.PathPrefix("/api").Subrouter()
 		r.StrictSlash(true)
+		r.Use(traceRequest, s.logRequest, instrument, s.validate)
+
+		r.HandleFunc("/openapi.yaml", s.handleSpec).Methods("GET")
 
 		r.Handle("/games", appHandler(s.handleGameList)).Methods("GET")
-		r.HandleFunc("/games", s.handleGameCreate).Methods("POST")
-		r.HandleFunc("/games/{id}", s.handleGameRead).Methods("GET")
-		r.HandleFunc("/games/{id}/move/{move}", s.handleGameMove).Methods("POST")
-		r.HandleFunc("/games/{id}/resign", s.handleGameResign).Methods("POST")
+		r.Handle("/games", appHandler(s.handleGameCreate)).Methods("POST")
+		r.Handle("/games/{id}", appHandler(s.handleGameRead)).Methods("GET")
+		r.Handle("/games/{id}/move/{move}", appHandler(s.handleGameMove)).Methods("POST")
+		r.Handle("/games/{id}/resign", appHandler(s.handleGameResign)).Methods("POST")
+		r.Handle("/games/{id}/vacation", appHandler(s.handleGameVacation)).Methods("POST")
+		r.Handle("/games/{id}/rematch", appHandler(s.handleGameRematch)).Methods("POST")
+		r.Handle("/games/{id}/series", appHandler(s.handleGameSeries)).Methods("GET")
+		r.Handle("/games/{id}/board.{format:svg|png}", appHandler(s.handleGameBoard)).Methods("GET")
+		r.Handle("/games/{id}/replay.gif", appHandler(s.handleGameReplay)).Methods("GET")
+		r.Handle("/board.{format:svg|png}", appHandler(s.handleBoard)).Methods("GET")
+
+		r.Handle("/bots", appHandler(s.handleBotList)).Methods("GET")
+		r.Handle("/bots/{name}", appHandler(s.handleBotRegister)).Methods("PUT")
+		r.Handle("/bots/{name}", appHandler(s.handleBotUnregister)).Methods("DELETE")
+		r.Handle("/bots/{name}/next", appHandler(s.handleBotNext)).Methods("GET")
+		r.Handle("/bots/{name}/requests/{request}/move/{move}", appHandler(s.handleBotMove)).Methods("POST")
+		r.Handle("/bots/{name}/ws", appHandler(s.handleBotSocket)).Methods("GET")
+
+		s.registerLichessRoutes(r)
 	}
 
 	// Assets.
@@ -72,69 +156,69 @@ func (s *Server) Open() (err error) {
 	return nil
 }
 
+// Close stops accepting connections and waits for in-flight requests to
+// complete, up to ShutdownTimeout.
 func (s *Server) Close() error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	s.cancel()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
 	defer cancel()
 
-	return s.server.Shutdown(ctx)
+	if err := s.server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("error shutting down HTTP server: %v", err)
+	}
+
+	return nil
 }
 
-func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+// ServeHTTP serves the request without a listener, e.g. in tests.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.router.ServeHTTP(w, r)
 }
 
 func (s *Server) handleGameList(w http.ResponseWriter, r *http.Request) error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
 	defer cancel()
 
-	opts := &workflowservice.ListOpenWorkflowExecutionsRequest{
-		Filters: &workflowservice.ListOpenWorkflowExecutionsRequest_TypeFilter{
-			TypeFilter: &filter.WorkflowTypeFilter{
-				Name: "GameWorkflow",
-			},
-		},
-	}
-	resp, err := s.TemporalClient.ListOpenWorkflow(ctx, opts)
+	ret, err := s.listGames(ctx)
 	if err != nil {
 		return err
 	}
 
-	ret := make([]string, len(resp.Executions))
-	for idx, exec := range resp.Executions {
-		if exec.Execution == nil {
-			continue
-		}
-		ret[idx] = exec.Execution.WorkflowId
-	}
-
-	err = json.NewEncoder(w).Encode(ret)
-	if err != nil {
-		return ResponseError{}
-	}
-
-	return nil
+	return writeJSON(w, ret)
 }
 
-func (s *Server) handleGameCreate(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+func (s *Server) handleGameCreate(w http.ResponseWriter, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
 	defer cancel()
 
 	// Read the payload.
 	params := game.GameWorkflowParams{}
 	dec := json.NewDecoder(r.Body)
 	if err := dec.Decode(&params); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return badRequest(ErrInvalidRequest, "Payload is not valid JSON.")
+	}
+	if params.Mode != "" && params.Mode != game.Live && params.Mode != game.Correspondence {
+		return badRequest(ErrInvalidArgument, "Game mode is unknown.")
+	}
+	if params.Correspondence != nil {
+		if err := params.Correspondence.Validate(); err != nil {
+			return badRequest(ErrInvalidArgument, fmt.Sprintf("Correspondence settings are invalid: %v.", err))
+		}
+		if err := s.NotifyAllowlist.Check(params.Correspondence.Notify); err != nil {
+			return badRequest(ErrInvalidArgument, fmt.Sprintf("Notification recipient is not allowed: %v.", err))
+		}
+	}
+	if _, ok := s.engineQueue(params.Engine); !ok {
+		return badRequest(ErrUnknownEngine, "Engine is unknown.")
 	}
 
 	opts := client.StartWorkflowOptions{
-		ID:        uuid.New().String(),
-		TaskQueue: "queue",
+		ID: uuid.New().String(),
 	}
-	wr, err := s.TemporalClient.ExecuteWorkflow(ctx, opts, game.GameWorkflow, params)
+	wr, err := s.startGame(ctx, opts, params)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return err
 	}
 
 	ret := struct {
@@ -142,102 +226,306 @@ func (s *Server) handleGameCreate(w http.ResponseWriter, r *http.Request) {
 	}{
 		ID: wr.GetID(),
 	}
-	err = json.NewEncoder(w).Encode(ret)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+
+	return writeJSON(w, ret)
 }
 
-func (s *Server) handleGameRead(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+func (s *Server) handleGameRead(w http.ResponseWriter, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
 	defer cancel()
 
 	vars := mux.Vars(r)
 	workflowID := vars["id"]
 
-	info := game.GameInfo{} // Response.
-
-	// Query workflow.
-	opts := client.QueryWorkflowWithOptionsRequest{
-		WorkflowID:           workflowID,
-		QueryType:            "info",
-		QueryRejectCondition: enums.QUERY_REJECT_CONDITION_NOT_OPEN,
+	notation, err := game.ParseNotation(r.URL.Query().Get("notation"))
+	if err != nil {
+		return badRequest(ErrInvalidArgument, "Notation is unknown.")
 	}
-	resp, err := s.TemporalClient.QueryWorkflowWithOptions(ctx, &opts)
+
+	info, err := s.readGame(ctx, workflowID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return err
 	}
 
-	// If rejected, the workflow is completed. Return is value.
-	if resp.QueryRejected != nil {
-		err := s.TemporalClient.GetWorkflow(ctx, workflowID, "").Get(ctx, &info)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		goto ret
+	info, err = info.WithNotation(notation)
+	if err != nil {
+		return err
 	}
 
-	err = resp.QueryResult.Get(&info)
+	return writeJSON(w, info)
+}
+
+func (s *Server) handleGameMove(w http.ResponseWriter, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	workflowID := vars["id"]
+
+	notation, err := game.ParseNotation(r.URL.Query().Get("notation"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return badRequest(ErrInvalidArgument, "Notation is unknown.")
 	}
 
-ret:
-	err = json.NewEncoder(w).Encode(info)
+	if err := s.playMove(ctx, workflowID, vars["move"], notation); err != nil {
+		return err
+	}
+
+	resp := struct{ OK bool }{OK: true}
+	return writeJSON(w, resp)
+}
+
+func (s *Server) handleGameResign(w http.ResponseWriter, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	workflowID := vars["id"]
+
+	err := s.TemporalClient.SignalWorkflow(ctx, workflowID, "", "resign", struct{}{})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return err
 	}
+
+	resp := struct{ OK bool }{OK: true}
+	return writeJSON(w, resp)
 }
 
-func (s *Server) handleGameMove(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+func (s *Server) handleGameVacation(w http.ResponseWriter, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
 	defer cancel()
 
 	vars := mux.Vars(r)
 	workflowID := vars["id"]
 
-	err := s.TemporalClient.SignalWorkflow(ctx, workflowID, "", "move", vars["move"])
+	req := struct {
+		Days int `json:"days"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Days < 1 {
+		return badRequest(ErrInvalidArgument, "Number of days is invalid.")
+	}
+
+	err := s.TemporalClient.SignalWorkflow(ctx, workflowID, "", "vacation", req.Days)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return err
 	}
 
 	resp := struct{ OK bool }{OK: true}
-	err = json.NewEncoder(w).Encode(resp)
+	return writeJSON(w, resp)
+}
+
+func (s *Server) handleGameRematch(w http.ResponseWriter, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	workflowID := vars["id"]
+
+	info, err := s.readGame(ctx, workflowID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return err
+	}
+	if info.Outcome == chess.NoOutcome {
+		return &ResponseError{Status: http.StatusConflict, Code: ErrGameInProgress, Reason: "Game is still in progress."}
 	}
+
+	// The identifier of the rematch is derived from the previous game so both
+	// sides asking for a rematch end up playing the same game.
+	opts := client.StartWorkflowOptions{
+		ID:                    uuid.NewSHA1(rematchNamespace, []byte(workflowID)).String(),
+		WorkflowIDReusePolicy: enums.WORKFLOW_ID_REUSE_POLICY_REJECT_DUPLICATE,
+	}
+	wr, err := s.startGame(ctx, opts, game.Rematch(workflowID, info))
+	var started *serviceerror.WorkflowExecutionAlreadyStarted
+	if err != nil && !errors.As(err, &started) {
+		return err
+	}
+
+	ret := struct {
+		ID string `json:"id"`
+	}{
+		ID: opts.ID,
+	}
+	if wr != nil {
+		ret.ID = wr.GetID()
+	}
+
+	return writeJSON(w, ret)
 }
 
-func (s *Server) handleGameResign(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+func (s *Server) handleGameSeries(w http.ResponseWriter, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
 	defer cancel()
 
 	vars := mux.Vars(r)
 	workflowID := vars["id"]
 
-	err := s.TemporalClient.SignalWorkflow(ctx, workflowID, "", "resign", struct{}{})
+	info, err := s.readGame(ctx, workflowID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return err
 	}
 
-	resp := struct{ OK bool }{OK: true}
-	err = json.NewEncoder(w).Encode(resp)
+	// The series carried by the game does not include its own result yet.
+	series := info.Series
+	inProgress := info.Outcome == chess.NoOutcome
+	if !inProgress {
+		series = series.Add(workflowID, info.Outcome, info.Color)
+	} else if series == nil {
+		series = &game.Series{Games: []string{}}
+	}
+
+	ret := struct {
+		*game.Series
+		Current    string `json:"current"`
+		InProgress bool   `json:"inProgress"`
+	}{
+		Series:     series,
+		Current:    workflowID,
+		InProgress: inProgress,
+	}
+
+	return writeJSON(w, ret)
+}
+
+// rematchNamespace is used to derive the identifier of rematches.
+var rematchNamespace = uuid.MustParse("4c1b8f8e-5a0e-4f4b-9a57-0d6c3f2e9b71")
+
+// startGame starts a new game workflow. The parent game is also recorded as a
+// search attribute so rematches can be found using the visibility API.
+func (s *Server) startGame(ctx context.Context, opts client.StartWorkflowOptions, params game.GameWorkflowParams) (client.WorkflowRun, error) {
+	opts.TaskQueue = s.TaskQueue
+	if params.Mode == "" {
+		params.Mode = game.Live
+	}
+	if params.Mode == game.Correspondence && params.Correspondence == nil {
+		settings := game.DefaultCorrespondenceSettings
+		params.Correspondence = &settings
+	}
+	if params.Mode != game.Correspondence {
+		params.Correspondence = nil
+	}
+	params.Idle = s.IdlePolicy.For(params.Mode)
+	queue, ok := s.engineQueue(params.Engine)
+	if !ok {
+		return nil, fmt.Errorf("unknown engine %q", params.Engine)
+	}
+	params.EngineQueue = queue
+	if params.ParentID != "" {
+		opts.SearchAttributes = map[string]interface{}{
+			game.ParentIDSearchAttribute: params.ParentID,
+		}
+	}
+
+	run, err := s.TemporalClient.ExecuteWorkflow(ctx, opts, game.GameWorkflow, params)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
+	}
+	logr.FromContextOrDiscard(ctx).Info("Game started", "new_game_id", run.GetID(), "mode", params.Mode, "engine", params.Engine)
+
+	return run, nil
+}
+
+// engineQueue returns the task queue of the engine or remote bot with the
+// given name.
+func (s *Server) engineQueue(name string) (string, bool) {
+	if name == "" {
+		return s.EngineTaskQueue, true
+	}
+	if queue, ok := s.EngineTaskQueues[name]; ok {
+		return queue, true
 	}
+	if s.Bots != nil {
+		if _, ok := s.Bots.Bot(name); ok {
+			return game.RemoteBotQueue(name), true
+		}
+	}
+	return "", false
 }
 
-func ListenAndServeDebug() error {
-	h := http.NewServeMux()
-	h.Handle("/metrics", promhttp.Handler())
-	return http.ListenAndServe(":6060", h)
+// listGames returns the identifiers of the games in progress.
+func (s *Server) listGames(ctx context.Context) ([]string, error) {
+	opts := &workflowservice.ListOpenWorkflowExecutionsRequest{
+		Filters: &workflowservice.ListOpenWorkflowExecutionsRequest_TypeFilter{
+			TypeFilter: &filter.WorkflowTypeFilter{
+				Name: "GameWorkflow",
+			},
+		},
+	}
+	resp, err := s.TemporalClient.ListOpenWorkflow(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]string, len(resp.Executions))
+	for idx, exec := range resp.Executions {
+		if exec.Execution == nil {
+			continue
+		}
+		ret[idx] = exec.Execution.WorkflowId
+	}
+
+	return ret, nil
+}
+
+// playMove sends the move of the user to the game. The move is validated here
+// since the workflow ignores illegal moves.
+func (s *Server) playMove(ctx context.Context, workflowID, move string, notation game.Notation) error {
+	info, err := s.readGame(ctx, workflowID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Outcome != chess.NoOutcome:
+		return &ResponseError{Status: http.StatusConflict, Code: ErrGameOver, Reason: "Game is over."}
+	case info.Turn != game.User:
+		return &ResponseError{Status: http.StatusConflict, Code: ErrNotYourTurn, Reason: "It is not the user's turn."}
+	}
+	pos, err := info.Position()
+	if err != nil {
+		return err
+	}
+	uci, err := game.DecodeMove(pos, move, notation)
+	if err != nil {
+		return badRequest(ErrInvalidArgument, "Move is illegal or its notation is invalid.")
+	}
+
+	signal := game.MoveSignal{Move: uci, Trace: tracing.Inject(ctx)}
+	return s.TemporalClient.SignalWorkflow(ctx, workflowID, "", "move", signal)
+}
+
+// readGame returns the state of a game. Completed games are not queryable so
+// their final state is taken from the result of the workflow.
+func (s *Server) readGame(ctx context.Context, workflowID string) (*game.GameInfo, error) {
+	info := game.GameInfo{}
+
+	// Query workflow.
+	opts := client.QueryWorkflowWithOptionsRequest{
+		WorkflowID:           workflowID,
+		QueryType:            "info",
+		QueryRejectCondition: enums.QUERY_REJECT_CONDITION_NOT_OPEN,
+	}
+	resp, err := s.TemporalClient.QueryWorkflowWithOptions(ctx, &opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// If rejected, the workflow is completed. Return is value unless the
+	// workflow did not complete successfully, e.g. it was terminated.
+	if resp.QueryRejected != nil {
+		err := s.TemporalClient.GetWorkflow(ctx, workflowID, "").Get(ctx, &info)
+		var execErr *temporal.WorkflowExecutionError
+		if errors.As(err, &execErr) {
+			return nil, &ResponseError{Status: http.StatusConflict, Code: ErrQueryRejected, Reason: "Game ended without a result."}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &info, nil
+	}
+
+	if err := resp.QueryResult.Get(&info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
 }
@@ -0,0 +1,289 @@
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/notnil/chess"
+	"go.temporal.io/api/enums/v1"
+	querypb "go.temporal.io/api/query/v1"
+	"go.temporal.io/api/serviceerror"
+	workflowpb "go.temporal.io/api/workflow/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
+
+	"github.com/sevein/chesstempo/game"
+	chesshttp "github.com/sevein/chesstempo/http"
+	"github.com/sevein/chesstempo/notify"
+)
+
+// fakeTemporal is the subset of the Temporal client used by the server. Games
+// that are over reject queries like the workflows that completed.
+type fakeTemporal struct {
+	client.Client
+
+	mu      sync.Mutex
+	games   map[string]*game.GameInfo
+	err     error // Returned by every call when set.
+	signals []string
+	started []game.GameWorkflowParams
+}
+
+func newFakeTemporal() *fakeTemporal {
+	return &fakeTemporal{
+		games: map[string]*game.GameInfo{
+			"live":    newInfo(game.User),
+			"machine": newInfo(game.Machine, "e2e4"),
+			"over":    newInfo(game.User, "f2f3", "e7e5", "g2g4", "d8h4"),
+		},
+	}
+}
+
+// newInfo returns the state of a game of the user playing white after the
+// given moves.
+func newInfo(turn game.Turn, moves ...string) *game.GameInfo {
+	g := chess.NewGame(chess.UseNotation(chess.UCINotation{}))
+	for _, move := range moves {
+		if err := g.MoveStr(move); err != nil {
+			panic(err)
+		}
+	}
+	return game.NewInfoFromGame(g, game.GameWorkflowParams{Color: game.White, Mode: game.Live}, turn)
+}
+
+func (c *fakeTemporal) game(id string) (*game.GameInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	info, ok := c.games[id]
+	if !ok {
+		return nil, serviceerror.NewNotFound("workflow not found")
+	}
+	return info, nil
+}
+
+func (c *fakeTemporal) QueryWorkflowWithOptions(ctx context.Context, req *client.QueryWorkflowWithOptionsRequest) (*client.QueryWorkflowWithOptionsResponse, error) {
+	info, err := c.game(req.WorkflowID)
+	if err != nil {
+		return nil, err
+	}
+	if info.Outcome != chess.NoOutcome {
+		return &client.QueryWorkflowWithOptionsResponse{
+			QueryRejected: &querypb.QueryRejected{Status: enums.WORKFLOW_EXECUTION_STATUS_COMPLETED},
+		}, nil
+	}
+	payloads, err := converter.GetDefaultDataConverter().ToPayloads(info)
+	if err != nil {
+		return nil, err
+	}
+	return &client.QueryWorkflowWithOptionsResponse{QueryResult: client.NewValue(payloads)}, nil
+}
+
+func (c *fakeTemporal) GetWorkflow(ctx context.Context, workflowID, runID string) client.WorkflowRun {
+	return &fakeRun{id: workflowID, client: c}
+}
+
+func (c *fakeTemporal) DescribeWorkflowExecution(ctx context.Context, workflowID, runID string) (*workflowservice.DescribeWorkflowExecutionResponse, error) {
+	if _, err := c.game(workflowID); err != nil {
+		return nil, err
+	}
+	startTime := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	return &workflowservice.DescribeWorkflowExecutionResponse{
+		WorkflowExecutionInfo: &workflowpb.WorkflowExecutionInfo{StartTime: &startTime},
+	}, nil
+}
+
+func (c *fakeTemporal) SignalWorkflow(ctx context.Context, workflowID, runID, signalName string, arg interface{}) error {
+	if _, err := c.game(workflowID); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.signals = append(c.signals, workflowID+"/"+signalName)
+	return nil
+}
+
+func (c *fakeTemporal) ExecuteWorkflow(ctx context.Context, options client.StartWorkflowOptions, workflow interface{}, args ...interface{}) (client.WorkflowRun, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.started = append(c.started, args[0].(game.GameWorkflowParams))
+	return &fakeRun{id: options.ID, client: c}, nil
+}
+
+func (c *fakeTemporal) ListOpenWorkflow(ctx context.Context, request *workflowservice.ListOpenWorkflowExecutionsRequest) (*workflowservice.ListOpenWorkflowExecutionsResponse, error) {
+	return &workflowservice.ListOpenWorkflowExecutionsResponse{}, c.err
+}
+
+// fakeRun returns the state of the game as the result of the workflow.
+type fakeRun struct {
+	id     string
+	client *fakeTemporal
+}
+
+func (r *fakeRun) GetID() string    { return r.id }
+func (r *fakeRun) GetRunID() string { return "run" }
+
+func (r *fakeRun) Get(ctx context.Context, valuePtr interface{}) error {
+	info, err := r.client.game(r.id)
+	if err != nil {
+		return err
+	}
+	blob, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(blob, valuePtr)
+}
+
+func newServer(tc *fakeTemporal) *chesshttp.Server {
+	s := chesshttp.NewServer()
+	s.TemporalClient = tc
+	s.EngineTaskQueues = map[string]string{"strong": "engine-strong"}
+	s.LichessLevels = map[int]string{5: "strong"}
+	s.NotifyAllowlist = notify.Allowlist{WebhookHosts: []string{"example.com"}}
+	return s
+}
+
+func serve(s *chesshttp.Server, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	return rec
+}
+
+// checkError checks the status and the code of an error of the API.
+func checkError(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+
+	if rec.Code != status {
+		t.Errorf("status: got %d, want %d (%s)", rec.Code, status, rec.Body)
+	}
+	if code == "" {
+		return
+	}
+	er := chesshttp.ResponseError{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &er); err != nil {
+		t.Fatalf("body is not an error: %v", err)
+	}
+	if er.Status != status || er.Code != code || er.Reason == "" {
+		t.Errorf("body: got %+v, want status %d and code %q", er, status, code)
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		err    error
+		status int
+		code   string
+		reason string
+	}{
+		{serviceerror.NewNotFound("workflow not found"), http.StatusNotFound, chesshttp.ErrNotFound, "Game not found."},
+		{serviceerror.NewInvalidArgument("id is too long"), http.StatusBadRequest, chesshttp.ErrInvalidArgument, "id is too long"},
+		{serviceerror.NewQueryFailed("query failed"), http.StatusConflict, chesshttp.ErrQueryRejected, "Game cannot be queried."},
+		{serviceerror.NewWorkflowExecutionAlreadyStarted("started", "", ""), http.StatusConflict, chesshttp.ErrAlreadyExists, "Game already exists."},
+		{serviceerror.NewUnavailable("connection refused"), http.StatusServiceUnavailable, chesshttp.ErrUnavailable, "Service unavailable."},
+		{serviceerror.NewDeadlineExceeded("deadline exceeded"), http.StatusGatewayTimeout, chesshttp.ErrTimeout, "Request timed out."},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout, chesshttp.ErrTimeout, "Request timed out."},
+		{errors.New("secret details"), http.StatusInternalServerError, chesshttp.ErrInternal, "Internal error."},
+	}
+	for _, tt := range tests {
+		tc := newFakeTemporal()
+		tc.err = tt.err
+		rec := serve(newServer(tc), "GET", "/api/games/live", "")
+
+		checkError(t, rec, tt.status, tt.code)
+		if body := rec.Body.String(); !strings.Contains(body, tt.reason) {
+			t.Errorf("%v: got body %s, want reason %q", tt.err, body, tt.reason)
+		}
+	}
+}
+
+func TestGameHandlers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		status int
+		code   string
+		signal string
+	}{
+		{"read", "GET", "/api/games/live?notation=san", "", http.StatusOK, "", ""},
+		{"read finished", "GET", "/api/games/over", "", http.StatusOK, "", ""},
+		{"read unknown", "GET", "/api/games/unknown", "", http.StatusNotFound, chesshttp.ErrNotFound, ""},
+		{"read with unknown notation", "GET", "/api/games/live?notation=xyz", "", http.StatusBadRequest, "", ""},
+		{"move", "POST", "/api/games/live/move/e2e4", "", http.StatusOK, "", "live/move"},
+		{"move in san", "POST", "/api/games/live/move/Nf3?notation=san", "", http.StatusOK, "", "live/move"},
+		{"illegal move", "POST", "/api/games/live/move/e2e5", "", http.StatusBadRequest, chesshttp.ErrInvalidArgument, ""},
+		{"move out of turn", "POST", "/api/games/machine/move/e7e5", "", http.StatusConflict, chesshttp.ErrNotYourTurn, ""},
+		{"move after the game", "POST", "/api/games/over/move/e2e4", "", http.StatusConflict, chesshttp.ErrGameOver, ""},
+		{"resign", "POST", "/api/games/live/resign", "", http.StatusOK, "", "live/resign"},
+		{"vacation", "POST", "/api/games/live/vacation", `{"days": 2}`, http.StatusOK, "", "live/vacation"},
+		{"vacation without days", "POST", "/api/games/live/vacation", `{"days": 0}`, http.StatusBadRequest, "", ""},
+		{"rematch in progress", "POST", "/api/games/live/rematch", "", http.StatusConflict, chesshttp.ErrGameInProgress, ""},
+		{"rematch", "POST", "/api/games/over/rematch", "", http.StatusOK, "", ""},
+		{"series", "GET", "/api/games/over/series", "", http.StatusOK, "", ""},
+		{"create", "POST", "/api/games", `{"color": "white"}`, http.StatusOK, "", ""},
+		{"create with engine", "POST", "/api/games", `{"engine": "strong"}`, http.StatusOK, "", ""},
+		{"create with unknown engine", "POST", "/api/games", `{"engine": "weak"}`, http.StatusBadRequest, chesshttp.ErrUnknownEngine, ""},
+		{"create with unknown mode", "POST", "/api/games", `{"mode": "blitz"}`, http.StatusBadRequest, "", ""},
+		{"create with webhook", "POST", "/api/games", `{"mode": "correspondence", "correspondence": {"daysPerMove": 3, "notify": {"webhook": "https://example.com/hook"}}}`, http.StatusOK, "", ""},
+		{"create with disallowed webhook", "POST", "/api/games", `{"mode": "correspondence", "correspondence": {"daysPerMove": 3, "notify": {"webhook": "https://example.org/hook"}}}`, http.StatusBadRequest, chesshttp.ErrInvalidArgument, ""},
+		{"create with invalid payload", "POST", "/api/games", `{`, http.StatusBadRequest, chesshttp.ErrInvalidRequest, ""},
+		{"list", "GET", "/api/games", "", http.StatusOK, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := newFakeTemporal()
+			rec := serve(newServer(tc), tt.method, tt.target, tt.body)
+
+			checkError(t, rec, tt.status, tt.code)
+			if tt.signal != "" && (len(tc.signals) != 1 || tc.signals[0] != tt.signal) {
+				t.Errorf("signals: got %v, want %s", tc.signals, tt.signal)
+			}
+			if tt.status != http.StatusOK && (len(tc.signals) > 0 || len(tc.started) > 0) {
+				t.Errorf("failed request signaled %v and started %d games", tc.signals, len(tc.started))
+			}
+		})
+	}
+}
+
+func TestGameCreateEngineQueue(t *testing.T) {
+	t.Parallel()
+
+	tc := newFakeTemporal()
+	s := newServer(tc)
+	for _, body := range []string{`{}`, `{"engine": "strong"}`} {
+		if rec := serve(s, "POST", "/api/games", body); rec.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d (%s)", body, rec.Code, rec.Body)
+		}
+	}
+
+	if got := tc.started[0].EngineQueue; got != s.EngineTaskQueue {
+		t.Errorf("default engine: got queue %q, want %q", got, s.EngineTaskQueue)
+	}
+	if got := tc.started[1].EngineQueue; got != "engine-strong" {
+		t.Errorf("strong engine: got queue %q, want %q", got, "engine-strong")
+	}
+}
@@ -0,0 +1,699 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/notnil/chess"
+	"go.temporal.io/sdk/client"
+
+	"github.com/sevein/chesstempo/game"
+)
+
+// The Lichess facade implements the subset of the Board API of Lichess that
+// clients need to play against the machine: creating challenges against the
+// AI, streaming events and games, moving, resigning and offering draws. The
+// Bot API is served as well since it shares the same endpoints. Games are
+// played by a single anonymous account and the token sent by clients is
+// ignored.
+//
+// See https://lichess.org/api#tag/Board.
+
+const (
+	lichessUserID   = "anonymous"
+	lichessUsername = "Anonymous"
+
+	// lichessAILevel is the level reported for the machine when it plays
+	// with an engine that is not listed in Server.LichessLevels.
+	lichessAILevel = 8
+
+	// lichessUnlimited is the time left reported by Lichess when the game
+	// has no clock.
+	lichessUnlimited = 2147483647
+)
+
+// Polling intervals of the streams. Lichess sends an empty line every few
+// seconds to keep idle streams open.
+var (
+	lichessGamePollInterval  = time.Second / 2
+	lichessEventPollInterval = time.Second * 2
+	lichessKeepAliveInterval = time.Second * 7
+)
+
+func (s *Server) registerLichessRoutes(r *mux.Router) {
+	r.Handle("/account", lichessHandler(s.handleLichessAccount)).Methods("GET")
+	r.Handle("/challenge/ai", lichessHandler(s.handleLichessChallengeAI)).Methods("POST")
+	r.Handle("/stream/event", lichessHandler(s.handleLichessEventStream)).Methods("GET")
+	r.Handle("/{api:board|bot}/game/stream/{id}", lichessHandler(s.handleLichessGameStream)).Methods("GET")
+	r.Handle("/{api:board|bot}/game/{id}/move/{move}", lichessHandler(s.handleLichessMove)).Methods("POST")
+	r.Handle("/{api:board|bot}/game/{id}/resign", lichessHandler(s.handleLichessResign)).Methods("POST")
+	r.Handle("/{api:board|bot}/game/{id}/draw/{accept}", lichessHandler(s.handleLichessDraw)).Methods("POST")
+}
+
+// lichessHandler writes errors using the error model of Lichess.
+type lichessHandler func(w http.ResponseWriter, r *http.Request) error
+
+func (h lichessHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := h(w, r)
+	if err == nil {
+		return
+	}
+
+	er := responseError(err)
+	if er.Status >= http.StatusInternalServerError {
+		logr.FromContextOrDiscard(r.Context()).Error(err, "Request failed", "code", er.Code)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(er.Status)
+	_ = json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{
+		Error: er.Reason,
+	})
+}
+
+type lichessOK struct {
+	OK bool `json:"ok"`
+}
+
+type lichessVariant struct {
+	Key   string `json:"key"`
+	Name  string `json:"name"`
+	Short string `json:"short"`
+}
+
+var (
+	lichessStandard     = lichessVariant{Key: "standard", Name: "Standard", Short: "Std"}
+	lichessFromPosition = lichessVariant{Key: "fromPosition", Name: "From Position", Short: "FEN"}
+)
+
+type lichessPlayer struct {
+	ID      string `json:"id,omitempty"`
+	Name    string `json:"name,omitempty"`
+	AILevel int    `json:"aiLevel,omitempty"`
+}
+
+type lichessOpponent struct {
+	ID       *string `json:"id"`
+	Username string  `json:"username"`
+	AI       int     `json:"ai,omitempty"`
+}
+
+type lichessGameState struct {
+	Type   string `json:"type"`
+	Moves  string `json:"moves"`
+	WTime  int64  `json:"wtime"`
+	BTime  int64  `json:"btime"`
+	WInc   int64  `json:"winc"`
+	BInc   int64  `json:"binc"`
+	Status string `json:"status"`
+	Winner string `json:"winner,omitempty"`
+	WDraw  bool   `json:"wdraw"`
+	BDraw  bool   `json:"bdraw"`
+}
+
+type lichessGameFull struct {
+	Type       string            `json:"type"`
+	ID         string            `json:"id"`
+	Rated      bool              `json:"rated"`
+	Variant    lichessVariant    `json:"variant"`
+	Clock      *struct{}         `json:"clock"`
+	Speed      string            `json:"speed"`
+	Perf       map[string]string `json:"perf"`
+	CreatedAt  int64             `json:"createdAt"`
+	White      lichessPlayer     `json:"white"`
+	Black      lichessPlayer     `json:"black"`
+	InitialFEN string            `json:"initialFen"`
+	State      lichessGameState  `json:"state"`
+}
+
+type lichessEventGame struct {
+	GameID      string          `json:"gameId"`
+	FullID      string          `json:"fullId"`
+	ID          string          `json:"id"`
+	Color       string          `json:"color"`
+	FEN         string          `json:"fen"`
+	HasMoved    bool            `json:"hasMoved"`
+	IsMyTurn    bool            `json:"isMyTurn"`
+	LastMove    string          `json:"lastMove"`
+	Opponent    lichessOpponent `json:"opponent"`
+	Perf        string          `json:"perf"`
+	Rated       bool            `json:"rated"`
+	Source      string          `json:"source"`
+	Speed       string          `json:"speed"`
+	Variant     lichessVariant  `json:"variant"`
+	Status      *lichessStatus  `json:"status,omitempty"`
+	Winner      string          `json:"winner,omitempty"`
+	Compat      map[string]bool `json:"compat"`
+	SecondsLeft *int64          `json:"secondsLeft,omitempty"`
+}
+
+type lichessEvent struct {
+	Type string            `json:"type"`
+	Game *lichessEventGame `json:"game,omitempty"`
+}
+
+type lichessStatus struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// lichessStatuses are the identifiers of the statuses of Lichess games.
+var lichessStatuses = map[string]int{
+	"started":   20,
+	"aborted":   25,
+	"mate":      30,
+	"resign":    31,
+	"stalemate": 32,
+	"timeout":   33,
+	"draw":      34,
+	"outoftime": 35,
+}
+
+func (s *Server) handleLichessAccount(w http.ResponseWriter, r *http.Request) error {
+	return writeJSON(w, struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	}{
+		ID:       lichessUserID,
+		Username: lichessUsername,
+	})
+}
+
+// handleLichessChallengeAI starts a game against the machine. Clocks are not
+// supported, games without days per turn are played live.
+func (s *Server) handleLichessChallengeAI(w http.ResponseWriter, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+	defer cancel()
+
+	if err := r.ParseForm(); err != nil {
+		return badRequest(ErrInvalidRequest, "Payload is invalid.")
+	}
+
+	params := game.GameWorkflowParams{FEN: r.PostForm.Get("fen")}
+	if v := r.PostForm.Get("level"); v != "" {
+		level, err := strconv.Atoi(v)
+		if err != nil || level < 1 || level > 8 {
+			return badRequest(ErrInvalidArgument, "Level must be between 1 and 8.")
+		}
+		params.Engine = s.lichessEngine(level)
+		if _, ok := s.engineQueue(params.Engine); !ok {
+			return badRequest(ErrUnknownEngine, "Engine of the level is not available.")
+		}
+	}
+	switch r.PostForm.Get("color") {
+	case "white":
+		params.Color = game.White
+	case "black":
+		params.Color = game.Black
+	case "", "random":
+		// The color is picked here so it can be returned.
+		var b [1]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return err
+		}
+		params.Color = game.White
+		if b[0]&1 == 1 {
+			params.Color = game.Black
+		}
+	default:
+		return badRequest(ErrInvalidArgument, "Color is unknown.")
+	}
+	switch r.PostForm.Get("variant") {
+	case "", lichessStandard.Key, lichessFromPosition.Key:
+	default:
+		return badRequest(ErrInvalidArgument, "Variant is not supported.")
+	}
+	if params.FEN != "" {
+		if _, err := chess.FEN(params.FEN); err != nil {
+			return badRequest(ErrInvalidArgument, "Position is invalid.")
+		}
+	}
+	if v := r.PostForm.Get("days"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil {
+			return badRequest(ErrInvalidArgument, "Days per turn is invalid.")
+		}
+		settings := game.DefaultCorrespondenceSettings
+		settings.DaysPerMove = days
+		if err := settings.Validate(); err != nil {
+			return badRequest(ErrInvalidArgument, "Days per turn is invalid.")
+		}
+		params.Mode = game.Correspondence
+		params.Correspondence = &settings
+	}
+
+	opts := client.StartWorkflowOptions{
+		ID: uuid.New().String(),
+	}
+	if _, err := s.startGame(ctx, opts, params); err != nil {
+		return err
+	}
+
+	variant, initialFEN, fen := lichessStandard, "startpos", chess.StartingPosition().String()
+	if params.FEN != "" {
+		variant, initialFEN, fen = lichessFromPosition, params.FEN, params.FEN
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(struct {
+		ID         string         `json:"id"`
+		Rated      bool           `json:"rated"`
+		Variant    lichessVariant `json:"variant"`
+		Speed      string         `json:"speed"`
+		Perf       string         `json:"perf"`
+		Source     string         `json:"source"`
+		Status     lichessStatus  `json:"status"`
+		CreatedAt  int64          `json:"createdAt"`
+		Player     string         `json:"player"`
+		InitialFEN string         `json:"initialFen"`
+		FEN        string         `json:"fen"`
+		Turns      int            `json:"turns"`
+	}{
+		ID:         opts.ID,
+		Variant:    variant,
+		Speed:      "correspondence",
+		Perf:       "correspondence",
+		Source:     "ai",
+		Status:     lichessStatus{ID: lichessStatuses["started"], Name: "started"},
+		CreatedAt:  time.Now().UnixMilli(),
+		Player:     lichessColor(params.Color.Chess()),
+		InitialFEN: initialFEN,
+		FEN:        fen,
+	})
+}
+
+// handleLichessGameStream streams the state of a game until it is over, see
+// https://lichess.org/api#operation/boardGameStream.
+func (s *Server) handleLichessGameStream(w http.ResponseWriter, r *http.Request) error {
+	workflowID := mux.Vars(r)["id"]
+	logger := logr.FromContextOrDiscard(r.Context())
+
+	full, err := s.lichessGameFull(r.Context(), workflowID)
+	if err != nil {
+		return err
+	}
+
+	stream := newNDJSONStream(w)
+	if err := stream.send(full); err != nil {
+		return nil
+	}
+
+	last := full.State
+	for last.Status == "started" {
+		if ok, err := stream.wait(r.Context(), s.ctx, lichessGamePollInterval); !ok || err != nil {
+			return nil
+		}
+
+		info, err := s.pollGame(workflowID)
+		if err != nil {
+			logger.Error(err, "Game stream ended")
+			return nil
+		}
+		// The time left changes on every poll.
+		state := newLichessGameState(info)
+		if state.Moves == last.Moves && state.Status == last.Status {
+			continue
+		}
+		if err := stream.send(state); err != nil {
+			return nil
+		}
+		last = state
+	}
+
+	return nil
+}
+
+// handleLichessEventStream streams the games that start and finish, starting
+// with those in progress, see https://lichess.org/api#operation/apiStreamEvent.
+func (s *Server) handleLichessEventStream(w http.ResponseWriter, r *http.Request) error {
+	logger := logr.FromContextOrDiscard(r.Context())
+
+	ids, err := s.pollGames()
+	if err != nil {
+		return err
+	}
+
+	stream := newNDJSONStream(w)
+	stream.flush()
+
+	// Games that cannot be read, e.g. they were terminated, are skipped.
+	emit := func(kind, id string) error {
+		ev, err := s.lichessEventGame(r.Context(), id)
+		if err != nil {
+			logger.V(1).Info("Game skipped", "game_id", id, "err", err.Error())
+			return nil
+		}
+		return stream.send(lichessEvent{Type: kind, Game: ev})
+	}
+
+	known := map[string]bool{}
+	for {
+		current := map[string]bool{}
+		for _, id := range ids {
+			current[id] = true
+			if !known[id] {
+				if err := emit("gameStart", id); err != nil {
+					return nil
+				}
+			}
+		}
+		for id := range known {
+			if !current[id] {
+				if err := emit("gameFinish", id); err != nil {
+					return nil
+				}
+			}
+		}
+		known = current
+
+		if ok, err := stream.wait(r.Context(), s.ctx, lichessEventPollInterval); !ok || err != nil {
+			return nil
+		}
+
+		ids, err = s.pollGames()
+		if err != nil {
+			logger.Error(err, "Event stream ended")
+			return nil
+		}
+	}
+}
+
+func (s *Server) handleLichessMove(w http.ResponseWriter, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	workflowID := vars["id"]
+
+	if err := s.playMove(ctx, workflowID, vars["move"], game.NotationUCI); err != nil {
+		return err
+	}
+
+	// The machine considers the offer in the next turn of the user.
+	if offer, _ := strconv.ParseBool(r.URL.Query().Get("offeringDraw")); offer {
+		if err := s.TemporalClient.SignalWorkflow(ctx, workflowID, "", "draw", struct{}{}); err != nil {
+			return err
+		}
+	}
+
+	return writeJSON(w, lichessOK{OK: true})
+}
+
+func (s *Server) handleLichessResign(w http.ResponseWriter, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+	defer cancel()
+
+	if err := s.TemporalClient.SignalWorkflow(ctx, mux.Vars(r)["id"], "", "resign", struct{}{}); err != nil {
+		return err
+	}
+
+	return writeJSON(w, lichessOK{OK: true})
+}
+
+// handleLichessDraw offers a draw to the machine, which only accepts draws
+// that can be claimed. The machine never offers draws so declining is a no-op.
+func (s *Server) handleLichessDraw(w http.ResponseWriter, r *http.Request) error {
+	ctx, cancel := context.WithTimeout(r.Context(), time.Second)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	workflowID := vars["id"]
+
+	switch vars["accept"] {
+	case "yes", "true":
+	case "no", "false":
+		if _, err := s.readGame(ctx, workflowID); err != nil {
+			return err
+		}
+		return writeJSON(w, lichessOK{OK: true})
+	default:
+		return badRequest(ErrInvalidArgument, "Accept must be yes or no.")
+	}
+
+	info, err := s.readGame(ctx, workflowID)
+	if err != nil {
+		return err
+	}
+	if info.Outcome != chess.NoOutcome {
+		return &ResponseError{Status: http.StatusBadRequest, Code: ErrGameOver, Reason: "Game is over."}
+	}
+
+	if err := s.TemporalClient.SignalWorkflow(ctx, workflowID, "", "draw", struct{}{}); err != nil {
+		return err
+	}
+
+	return writeJSON(w, lichessOK{OK: true})
+}
+
+// readGameWithTimeout reads the game with the timeout used by the handlers.
+func (s *Server) readGameWithTimeout(ctx context.Context, workflowID string) (*game.GameInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	return s.readGame(ctx, workflowID)
+}
+
+// pollGame reads the game for the streams, which share the query sent in the
+// last half of their interval.
+func (s *Server) pollGame(workflowID string) (*game.GameInfo, error) {
+	info, err := s.polls.get("game/"+workflowID, lichessGamePollInterval/2, func() (interface{}, error) {
+		return s.readGameWithTimeout(s.ctx, workflowID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info.(*game.GameInfo), nil
+}
+
+// pollGames lists the games in progress for the event streams, see pollGame.
+func (s *Server) pollGames() ([]string, error) {
+	ids, err := s.polls.get("games", lichessEventPollInterval/2, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(s.ctx, time.Second)
+		defer cancel()
+		return s.listGames(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids.([]string), nil
+}
+
+// lichessEngine returns the engine that plays at the level.
+func (s *Server) lichessEngine(level int) string {
+	for ; level > 0; level-- {
+		if engine, ok := s.LichessLevels[level]; ok {
+			return engine
+		}
+	}
+	return ""
+}
+
+// lichessLevel returns the highest level played by the engine.
+func (s *Server) lichessLevel(engine string) int {
+	for level := 8; level > 0; level-- {
+		if e, ok := s.LichessLevels[level]; ok && e == engine {
+			return level
+		}
+	}
+	return lichessAILevel
+}
+
+func (s *Server) lichessGameFull(ctx context.Context, workflowID string) (*lichessGameFull, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	info, err := s.readGame(ctx, workflowID)
+	if err != nil {
+		return nil, err
+	}
+	desc, err := s.TemporalClient.DescribeWorkflowExecution(ctx, workflowID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	full := &lichessGameFull{
+		Type:       "gameFull",
+		ID:         workflowID,
+		Variant:    lichessStandard,
+		Speed:      "correspondence",
+		Perf:       map[string]string{"name": "Correspondence"},
+		InitialFEN: "startpos",
+		State:      newLichessGameState(info),
+	}
+	if info.StartFEN != "" {
+		full.Variant, full.InitialFEN = lichessFromPosition, info.StartFEN
+	}
+	if at := desc.GetWorkflowExecutionInfo().GetStartTime(); at != nil {
+		full.CreatedAt = at.UnixMilli()
+	}
+
+	user := lichessPlayer{ID: lichessUserID, Name: lichessUsername}
+	machine := lichessPlayer{AILevel: s.lichessLevel(info.Engine)}
+	full.White, full.Black = user, machine
+	if info.Color == game.Black {
+		full.White, full.Black = machine, user
+	}
+
+	return full, nil
+}
+
+func (s *Server) lichessEventGame(ctx context.Context, workflowID string) (*lichessEventGame, error) {
+	info, err := s.readGameWithTimeout(ctx, workflowID)
+	if err != nil {
+		return nil, err
+	}
+
+	level := s.lichessLevel(info.Engine)
+	ev := &lichessEventGame{
+		GameID:   workflowID,
+		FullID:   workflowID,
+		ID:       workflowID,
+		Color:    lichessColor(info.Color.Chess()),
+		FEN:      info.FEN,
+		IsMyTurn: info.Turn == game.User && info.Outcome == chess.NoOutcome,
+		Opponent: lichessOpponent{Username: "A.I. level " + strconv.Itoa(level), AI: level},
+		Perf:     "correspondence",
+		Source:   "ai",
+		Speed:    "correspondence",
+		Variant:  lichessStandard,
+		Compat:   map[string]bool{"bot": true, "board": true},
+	}
+	if info.StartFEN != "" {
+		ev.Variant = lichessFromPosition
+	}
+	if n := len(info.Moves); n > 0 {
+		ev.LastMove = info.Moves[n-1]
+		ev.HasMoved = n > 1 || info.Color == game.White
+	}
+	if info.Deadline != nil {
+		left := int64(time.Until(*info.Deadline).Seconds())
+		ev.SecondsLeft = &left
+	}
+	if info.Outcome != chess.NoOutcome {
+		status, winner := lichessResult(info)
+		ev.Status = &lichessStatus{ID: lichessStatuses[status], Name: status}
+		ev.Winner = winner
+	}
+
+	return ev, nil
+}
+
+func newLichessGameState(info *game.GameInfo) lichessGameState {
+	state := lichessGameState{
+		Type:   "gameState",
+		Moves:  strings.Join(info.Moves, " "),
+		WTime:  lichessUnlimited,
+		BTime:  lichessUnlimited,
+		Status: "started",
+	}
+	if info.Deadline != nil {
+		left := time.Until(*info.Deadline).Milliseconds()
+		if info.Color == game.White {
+			state.WTime = left
+		} else {
+			state.BTime = left
+		}
+	}
+	if info.Outcome != chess.NoOutcome {
+		state.Status, state.Winner = lichessResult(info)
+	}
+	return state
+}
+
+// lichessResult returns the status and the winner of a finished game.
+func lichessResult(info *game.GameInfo) (status, winner string) {
+	switch info.Outcome {
+	case chess.WhiteWon:
+		winner = "white"
+	case chess.BlackWon:
+		winner = "black"
+	}
+
+	switch {
+	case info.TimedOut:
+		status = "outoftime"
+	case info.Abandoned:
+		status = "timeout"
+	case info.Method == chess.Checkmate:
+		status = "mate"
+	case info.Method == chess.Resignation:
+		status = "resign"
+	case info.Method == chess.Stalemate:
+		status = "stalemate"
+	default:
+		status = "draw"
+	}
+
+	return status, winner
+}
+
+func lichessColor(c chess.Color) string {
+	if c == chess.Black {
+		return "black"
+	}
+	return "white"
+}
+
+// ndjsonStream writes newline-delimited JSON, flushing every line.
+type ndjsonStream struct {
+	w       http.ResponseWriter
+	enc     *json.Encoder
+	written time.Time
+}
+
+func newNDJSONStream(w http.ResponseWriter) *ndjsonStream {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-store")
+	return &ndjsonStream{w: w, enc: json.NewEncoder(w), written: time.Now()}
+}
+
+func (s *ndjsonStream) send(v interface{}) error {
+	if err := s.enc.Encode(v); err != nil {
+		return err
+	}
+	s.flush()
+	return nil
+}
+
+func (s *ndjsonStream) flush() {
+	s.written = time.Now()
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// wait sleeps for the given interval, sending an empty line when the stream
+// has been idle for too long. It returns false when the client goes away or
+// the server is shutting down.
+func (s *ndjsonStream) wait(ctx, serverCtx context.Context, d time.Duration) (bool, error) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false, nil
+	case <-serverCtx.Done():
+		return false, nil
+	case <-timer.C:
+	}
+
+	if time.Since(s.written) < lichessKeepAliveInterval {
+		return true, nil
+	}
+	if _, err := s.w.Write([]byte("\n")); err != nil {
+		return false, err
+	}
+	s.flush()
+	return true, nil
+}
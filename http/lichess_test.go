@@ -0,0 +1,134 @@
+package http_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLichessHandlers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		form    string
+		status  int
+		reason  string // Reason of the error, empty when the request succeeds.
+		signals []string
+	}{
+		{"account", "GET", "/api/account", "", http.StatusOK, "", nil},
+		{"challenge", "POST", "/api/challenge/ai", "color=white", http.StatusCreated, "", nil},
+		{"challenge with level", "POST", "/api/challenge/ai", "level=5", http.StatusCreated, "", nil},
+		{"challenge with level out of range", "POST", "/api/challenge/ai", "level=9", http.StatusBadRequest, "Level must be between 1 and 8.", nil},
+		{"challenge with unknown color", "POST", "/api/challenge/ai", "color=red", http.StatusBadRequest, "Color is unknown.", nil},
+		{"challenge with unknown variant", "POST", "/api/challenge/ai", "variant=chess960", http.StatusBadRequest, "Variant is not supported.", nil},
+		{"challenge with invalid position", "POST", "/api/challenge/ai", "fen=xyz", http.StatusBadRequest, "Position is invalid.", nil},
+		{"challenge with invalid days", "POST", "/api/challenge/ai", "days=0", http.StatusBadRequest, "Days per turn is invalid.", nil},
+		{"move", "POST", "/api/board/game/live/move/e2e4", "", http.StatusOK, "", []string{"live/move"}},
+		{"move offering draw", "POST", "/api/bot/game/live/move/e2e4?offeringDraw=true", "", http.StatusOK, "", []string{"live/move", "live/draw"}},
+		{"illegal move", "POST", "/api/board/game/live/move/e2e5", "", http.StatusBadRequest, "Move is illegal or its notation is invalid.", nil},
+		{"move after the game", "POST", "/api/board/game/over/move/e2e4", "", http.StatusConflict, "Game is over.", nil},
+		{"move in unknown game", "POST", "/api/board/game/unknown/move/e2e4", "", http.StatusNotFound, "Game not found.", nil},
+		{"resign", "POST", "/api/board/game/live/resign", "", http.StatusOK, "", []string{"live/resign"}},
+		{"offer draw", "POST", "/api/board/game/live/draw/yes", "", http.StatusOK, "", []string{"live/draw"}},
+		{"decline draw", "POST", "/api/board/game/live/draw/no", "", http.StatusOK, "", nil},
+		{"offer draw after the game", "POST", "/api/board/game/over/draw/yes", "", http.StatusBadRequest, "Game is over.", nil},
+		{"answer draw with maybe", "POST", "/api/board/game/live/draw/maybe", "", http.StatusBadRequest, "Accept must be yes or no.", nil},
+		{"stream of unknown game", "GET", "/api/board/game/stream/unknown", "", http.StatusNotFound, "Game not found.", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := newFakeTemporal()
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.form))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rec := httptest.NewRecorder()
+			newServer(tc).ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Errorf("status: got %d, want %d (%s)", rec.Code, tt.status, rec.Body)
+			}
+			if tt.reason != "" {
+				body := map[string]string{}
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || len(body) != 1 || body["error"] != tt.reason {
+					t.Errorf("body: got %s, want error %q", rec.Body, tt.reason)
+				}
+			}
+			if !reflect.DeepEqual(tc.signals, tt.signals) {
+				t.Errorf("signals: got %v, want %v", tc.signals, tt.signals)
+			}
+		})
+	}
+}
+
+func TestLichessChallengeLevel(t *testing.T) {
+	t.Parallel()
+
+	// Levels without an engine are played by the engine of the closest
+	// lower level.
+	tests := map[string]string{"3": "", "5": "strong", "8": "strong"}
+	for level, engine := range tests {
+		tc := newFakeTemporal()
+		req := httptest.NewRequest("POST", "/api/challenge/ai", strings.NewReader("level="+level))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		newServer(tc).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusCreated || len(tc.started) != 1 {
+			t.Fatalf("level %s: got status %d (%s)", level, rec.Code, rec.Body)
+		}
+		if got := tc.started[0].Engine; got != engine {
+			t.Errorf("level %s: got engine %q, want %q", level, got, engine)
+		}
+	}
+}
+
+func TestLichessGameStream(t *testing.T) {
+	t.Parallel()
+
+	rec := serve(newServer(newFakeTemporal()), "GET", "/api/board/game/stream/over", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status: got %d (%s)", rec.Code, rec.Body)
+	}
+	if got, want := rec.Header().Get("Content-Type"), "application/x-ndjson"; got != want {
+		t.Errorf("content type: got %q, want %q", got, want)
+	}
+
+	// The stream of a finished game ends after the first line.
+	full := struct {
+		Type      string `json:"type"`
+		ID        string `json:"id"`
+		CreatedAt int64  `json:"createdAt"`
+		White     struct {
+			ID string `json:"id"`
+		} `json:"white"`
+		Black struct {
+			AILevel int `json:"aiLevel"`
+		} `json:"black"`
+		State struct {
+			Moves  string `json:"moves"`
+			Status string `json:"status"`
+			Winner string `json:"winner"`
+		} `json:"state"`
+	}{}
+	dec := json.NewDecoder(rec.Body)
+	if err := dec.Decode(&full); err != nil {
+		t.Fatal(err)
+	}
+	if dec.More() {
+		t.Error("stream has more than one line")
+	}
+	if full.Type != "gameFull" || full.ID != "over" || full.CreatedAt == 0 {
+		t.Errorf("got %+v", full)
+	}
+	if full.White.ID != "anonymous" || full.Black.AILevel != 8 {
+		t.Errorf("players: got %+v and %+v", full.White, full.Black)
+	}
+	if full.State.Moves != "f2f3 e7e5 g2g4 d8h4" || full.State.Status != "mate" || full.State.Winner != "black" {
+		t.Errorf("state: got %+v", full.State)
+	}
+}
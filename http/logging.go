@@ -0,0 +1,43 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// logRequest is a middleware that identifies every request and logs it when
+// it is served. Handlers find the logger of the request in its context, with
+// the identifiers of the request, the trace and the game.
+func (s *Server) logRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-Id")
+		if id == "" || len(id) > 128 {
+			id = uuid.New().String()
+		}
+		w.Header().Set("X-Request-Id", id)
+
+		logger := s.Logger.WithValues("request_id", id)
+		if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+			logger = logger.WithValues("trace_id", sc.TraceID().String())
+		}
+		if gameID := mux.Vars(r)["id"]; gameID != "" {
+			logger = logger.WithValues("game_id", gameID)
+		}
+
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(logr.NewContext(r.Context(), logger)))
+
+		logger.V(1).Info("Request served",
+			"method", r.Method,
+			"route", routeTemplate(r),
+			"status", sw.status,
+			"duration", time.Since(start).String(),
+		)
+	})
+}
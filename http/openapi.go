@@ -0,0 +1,135 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/go-logr/logr"
+)
+
+// Spec is the OpenAPI 3 document of the API.
+//
+//go:embed openapi.yaml
+var Spec []byte
+
+var specRouter = mustLoadSpec()
+
+func mustLoadSpec() routers.Router {
+	doc, err := openapi3.NewLoader().LoadFromData(Spec)
+	if err != nil {
+		panic(err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		panic(err)
+	}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		panic(err)
+	}
+	return router
+}
+
+func (s *Server) handleSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(Spec)
+}
+
+// validate is a middleware that rejects the requests that do not conform to
+// the specification. Responses are only validated when ValidateResponses is
+// set and violations are logged, since the client is not at fault.
+func (s *Server) validate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, params, err := specRouter.FindRoute(r)
+		if err != nil {
+			next.ServeHTTP(w, r) // Not described by the spec.
+			return
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: params,
+			Route:      route,
+			// Handlers check the tokens of the bots.
+			Options: &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+		}
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			writeError(w, r, badRequest(ErrInvalidRequest, requestErrorReason(err)))
+			return
+		}
+
+		if !s.ValidateResponses {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rec := &recorder{header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		resp := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 rec.status,
+			Header:                 rec.header,
+			Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+		}
+		resp.SetBodyBytes(rec.body.Bytes())
+		if err := openapi3filter.ValidateResponse(r.Context(), resp); err != nil {
+			logr.FromContextOrDiscard(r.Context()).Error(err, "Response does not conform to the specification")
+		}
+
+		for key, values := range rec.header {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+	})
+}
+
+// requestErrorReason describes the validation error without the details of
+// the schema, which are included by kin-openapi.
+func requestErrorReason(err error) string {
+	var reqErr *openapi3filter.RequestError
+	if errors.As(err, &reqErr) {
+		if reqErr.Parameter != nil {
+			return "Parameter " + reqErr.Parameter.Name + " is invalid."
+		}
+		var schemaErr *openapi3.SchemaError
+		if errors.As(reqErr.Err, &schemaErr) {
+			field := strings.Join(schemaErr.JSONPointer(), ".")
+			if field == "" {
+				return "Payload is invalid: " + schemaErr.Reason + "."
+			}
+			return "Field " + field + " is invalid: " + schemaErr.Reason + "."
+		}
+		if reqErr.RequestBody != nil {
+			return "Payload is invalid: " + reqErr.Reason + "."
+		}
+	}
+	return "Request is invalid."
+}
+
+// recorder buffers the response so it can be validated before it is sent.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *recorder) Header() http.Header {
+	return r.header
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+}
@@ -0,0 +1,51 @@
+package http
+
+import (
+	"sync"
+	"time"
+)
+
+// sharedPoll shares the results of the queries polled by the streams, so
+// streams of the same game, or of the games in progress, send a single query
+// per interval to Temporal regardless of their number.
+type sharedPoll struct {
+	mu      sync.Mutex
+	entries map[string]*pollEntry
+}
+
+type pollEntry struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+func newSharedPoll() *sharedPoll {
+	return &sharedPoll{entries: map[string]*pollEntry{}}
+}
+
+// get returns the result of fetch for the key, fetched by this or another
+// caller in the last maxAge.
+func (p *sharedPoll) get(key string, maxAge time.Duration, fetch func() (interface{}, error)) (interface{}, error) {
+	p.mu.Lock()
+	entry, ok := p.entries[key]
+	if ok {
+		p.mu.Unlock()
+		<-entry.done
+		return entry.value, entry.err
+	}
+	entry = &pollEntry{done: make(chan struct{})}
+	p.entries[key] = entry
+	p.mu.Unlock()
+
+	entry.value, entry.err = fetch()
+	close(entry.done)
+	time.AfterFunc(maxAge, func() {
+		p.mu.Lock()
+		if p.entries[key] == entry {
+			delete(p.entries, key)
+		}
+		p.mu.Unlock()
+	})
+
+	return entry.value, entry.err
+}
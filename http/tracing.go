@@ -0,0 +1,38 @@
+package http
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/sevein/chesstempo/tracing"
+)
+
+// traceRequest is a middleware that starts a span for every API request. It
+// continues the trace of the client when the request carries one.
+func traceRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		route := routeTemplate(r)
+		ctx, span := tracing.Start(ctx, r.Method+" "+route,
+			attribute.String("http.method", r.Method),
+			attribute.String("http.route", route),
+		)
+		defer span.End()
+
+		if id := span.SpanContext().TraceID(); id.IsValid() {
+			w.Header().Set("X-Trace-Id", id.String())
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.status_code", sw.status))
+		if sw.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+	})
+}
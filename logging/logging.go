@@ -0,0 +1,115 @@
+// Package logging builds the structured logger of the application.
+//
+// Loggers follow the verbosity conventions of logr: V(0) is always shown and
+// higher levels are shown as the verbosity of the Level increases. Errors are
+// always shown.
+package logging
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/zapr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+func Validate(format string) error {
+	switch format {
+	case FormatText, FormatJSON:
+		return nil
+	}
+	return errors.New("log format must be text or json")
+}
+
+// New returns a logger that writes to w in the given format.
+func New(w io.Writer, format string, level *Level) (logr.Logger, error) {
+	config := zap.NewProductionEncoderConfig()
+	config.TimeKey = "time"
+	config.EncodeTime = zapcore.ISO8601TimeEncoder
+	config.EncodeLevel = encodeLevel
+
+	var encoder zapcore.Encoder
+	switch format {
+	case FormatText:
+		encoder = zapcore.NewConsoleEncoder(config)
+	case FormatJSON:
+		encoder = zapcore.NewJSONEncoder(config)
+	default:
+		return logr.Discard(), Validate(format)
+	}
+
+	core := zapcore.NewCore(encoder, zapcore.AddSync(w), level.atom)
+	logger := zap.New(core, zap.AddCaller())
+
+	return zapr.NewLoggerWithOptions(logger, zapr.LogInfoLevel("v")), nil
+}
+
+// encodeLevel reports verbose messages as debug, their verbosity is found in
+// the "v" field.
+func encodeLevel(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+	if l < zapcore.InfoLevel {
+		enc.AppendString("debug")
+		return
+	}
+	zapcore.LowercaseLevelEncoder(l, enc)
+}
+
+// Level is the verbosity of the logger. It can be changed at runtime.
+type Level struct {
+	atom zap.AtomicLevel
+}
+
+func NewLevel(verbosity int) *Level {
+	l := &Level{atom: zap.NewAtomicLevel()}
+	l.Set(verbosity)
+	return l
+}
+
+func (l *Level) Set(verbosity int) {
+	l.atom.SetLevel(zapcore.Level(-verbosity))
+}
+
+func (l *Level) Get() int {
+	return -int(l.atom.Level())
+}
+
+// ServeHTTP reports the verbosity and changes it on PUT requests, e.g.:
+//
+//	curl -X PUT -d '{"verbosity": 2}' http://127.0.0.1:6060/log/level
+func (l *Level) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	payload := struct {
+		Verbosity int `json:"verbosity"`
+	}{}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, fmt.Sprintf("invalid payload: %v", err), http.StatusBadRequest)
+			return
+		}
+		if payload.Verbosity < 0 {
+			http.Error(w, "verbosity cannot be negative", http.StatusBadRequest)
+			return
+		}
+		l.Set(payload.Verbosity)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	payload.Verbosity = l.Get()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(payload)
+}
@@ -2,27 +2,50 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
 	"os"
 	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/sevein/chesstempo/game"
 	"github.com/sevein/chesstempo/http"
+	"github.com/sevein/chesstempo/logging"
+	"github.com/sevein/chesstempo/notify"
 	"github.com/sevein/chesstempo/temporal"
+	"github.com/sevein/chesstempo/tracing"
 
-	"github.com/go-logr/stdr"
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.temporal.io/api/enums/v1"
+	"go.temporal.io/sdk/activity"
 	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
 )
 
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	go func() { <-c; cancel() }()
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		cancel()
+		// A second signal skips the graceful shutdown.
+		<-c
+		os.Exit(1)
+	}()
 
 	m := NewMain()
 
+	if err := m.ParseFlags(os.Args[1:]); err == flag.ErrHelp {
+		os.Exit(1)
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	if err := m.Run(ctx); err != nil {
 		m.Close()
 		fmt.Fprintln(os.Stderr, err)
@@ -38,63 +61,252 @@ func main() {
 }
 
 type Main struct {
+	Config Config
+
 	Temporal       *temporal.Client
 	TemporalWorker worker.Worker
+	EngineWorker   worker.Worker
 	HTTPServer     *http.Server
+	DebugServer    *http.DebugServer
+	Bot            *game.Bot
+	Bots           *game.RemoteBots
+	Tracer         *tracing.Tracer
+	LogLevel       *logging.Level
 }
 
 func NewMain() *Main {
 	return &Main{
-		Temporal:   temporal.New(),
-		HTTPServer: http.NewServer(),
+		Config:      DefaultConfig(),
+		Temporal:    temporal.New(),
+		HTTPServer:  http.NewServer(),
+		DebugServer: http.NewDebugServer(),
+		Tracer:      tracing.New(),
+		LogLevel:    logging.NewLevel(0),
 	}
 }
 
-const (
-	namespace = "default"
-	embedded  = true
-	ephemeral = false
-	taskQueue = "queue"
-	addr      = ":9999"
-)
-
 func (m *Main) Run(ctx context.Context) error {
-	stdr.SetVerbosity(7)
-	logger := stdr.NewWithOptions(log.New(os.Stderr, "", log.LstdFlags), stdr.Options{LogCaller: stdr.All})
+	m.LogLevel.Set(m.Config.Log.Level)
+	logger, err := logging.New(os.Stderr, m.Config.Log.Format, m.LogLevel)
+	if err != nil {
+		return err
+	}
 	logger = logger.WithName("chesstempo")
 
+	// Set up tracing.
+	m.Tracer.Exporter = m.Config.Tracing.Exporter
+	m.Tracer.Endpoint = m.Config.Tracing.Endpoint
+	m.Tracer.Insecure = m.Config.Tracing.Insecure
+	if err := m.Tracer.Open(); err != nil {
+		return fmt.Errorf("failed to set up tracing: %v", err)
+	}
+
 	// Start Temporal client.
-	m.Temporal.Namespace = namespace
-	m.Temporal.Embedded = embedded
-	m.Temporal.Ephemeral = ephemeral
+	m.Temporal.Namespace = m.Config.Temporal.Namespace
+	m.Temporal.Embedded = m.Config.Temporal.Embedded
+	m.Temporal.Ephemeral = m.Config.Temporal.Ephemeral
+	m.Temporal.FrontendPort = m.Config.Temporal.FrontendPort
+	m.Temporal.DatabasePath = m.Config.Temporal.Database
+	m.Temporal.HostPort = m.Config.Temporal.HostPort
+	m.Temporal.TLS = m.Config.TemporalTLS()
+	if key := m.Config.Temporal.APIKey; key != "" {
+		m.Temporal.Credentials = temporal.APIKey(key)
+	}
+	m.Temporal.Metrics = prometheus.DefaultRegisterer
+	m.Temporal.ContextPropagators = []workflow.ContextPropagator{tracing.NewContextPropagator()}
+	m.Temporal.SearchAttributes = map[string]enums.IndexedValueType{
+		game.ParentIDSearchAttribute: enums.INDEXED_VALUE_TYPE_KEYWORD,
+	}
 	if err := m.Temporal.Create(logger.WithName("temporal")); err != nil {
 		return fmt.Errorf("failed to create Temporal client: %v", err)
 	}
 
 	// Start worker.
-	w := worker.New(m.Temporal.Client, taskQueue, worker.Options{})
+	w := worker.New(m.Temporal.Client, m.Config.Temporal.TaskQueue, worker.Options{
+		Identity:          workerIdentity(m.Config.Temporal.TaskQueue),
+		WorkerStopTimeout: m.Config.Shutdown.WorkerTimeout,
+	})
+	w.RegisterWorkflow(game.GameWorkflow)
+	w.RegisterActivityWithOptions(
+		game.NewNotifyActivity(
+			&notify.SMTP{Addr: m.Config.Notify.SMTPAddr, From: m.Config.Notify.SMTPFrom, Allowlist: m.Config.NotifyAllowlist()},
+			&notify.Webhook{Allowlist: m.Config.NotifyAllowlist()},
+		).Execute,
+		activity.RegisterOptions{Name: game.NotifyActivityName},
+	)
+	if m.Config.Engine.Enabled {
+		if err := m.startBot(w); err != nil {
+			engineUp.Set(0)
+			logger.Error(err, "Engine not available, the machine plays random moves")
+		} else {
+			engineUp.Set(1)
+			logger.Info("Bot activity worker enabled")
+		}
+	}
 	if err := w.Start(); err != nil {
+		return fmt.Errorf("failed to start Temporal worker: %v", err)
+	}
+	m.TemporalWorker = w
+
+	m.registerHealthChecks()
+
+	m.Bots = game.NewRemoteBots(m.Temporal.Client)
+	m.Bots.WorkerStopTimeout = m.Config.Shutdown.WorkerTimeout
+	m.Bots.MaxBots = m.Config.Bots.Max
+	if m.Bots.Path, err = m.Config.BotsFile(); err != nil {
 		return err
 	}
-	w.RegisterWorkflow(game.GameWorkflow)
+	if err := m.Bots.Load(); err != nil {
+		return fmt.Errorf("failed to load remote bots: %v", err)
+	}
 
 	// Start HTTP server.
+	m.HTTPServer.Logger = logger.WithName("http")
 	m.HTTPServer.TemporalClient = m.Temporal.Client
-	m.HTTPServer.Addr = addr
+	m.HTTPServer.ValidateResponses = m.Config.HTTP.ValidateResponses
+	m.HTTPServer.Addr = m.Config.HTTP.Addr
+	m.HTTPServer.TaskQueue = m.Config.Temporal.TaskQueue
+	m.HTTPServer.EngineTaskQueue = m.Config.Engine.TaskQueue
+	m.HTTPServer.EngineTaskQueues = m.Config.EngineQueues()
+	m.HTTPServer.IdlePolicy = m.Config.IdlePolicy()
+	m.HTTPServer.ShutdownTimeout = m.Config.Shutdown.HTTPTimeout
+	m.HTTPServer.Health = m.DebugServer.Health
+	m.HTTPServer.Bots = m.Bots
+	m.HTTPServer.NotifyAllowlist = m.Config.NotifyAllowlist()
+	m.HTTPServer.LichessLevels = m.Config.Lichess.Levels
 	if err := m.HTTPServer.Open(); err != nil {
 		return fmt.Errorf("failed to create web server: %v", err)
 	}
 	logger.Info("HTTP server listening", "addr", m.HTTPServer.Addr)
 
-	go func() { http.ListenAndServeDebug() }()
+	m.checkEngineQueues(ctx, logger)
+
+	if addr := m.Config.HTTP.DebugAddr; addr != "" {
+		m.DebugServer.Addr = addr
+		m.DebugServer.LogLevel = m.LogLevel
+		m.DebugServer.ShutdownTimeout = m.Config.Shutdown.HTTPTimeout
+		if err := m.DebugServer.Open(); err != nil {
+			return fmt.Errorf("failed to create debug server: %v", err)
+		}
+		logger.Info("Debug server listening", "addr", addr)
+	}
 
 	return nil
 }
 
+var engineUp = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "chesstempo_engine_up",
+	Help: "Whether the engine of the in-process bot activity worker is available.",
+})
+
+// startBot runs the bot activity in a worker of the main binary that polls the
+// task queue of the default engine. Games started before engines had their own
+// task queue schedule the activity in the queue of the workflows, so it is also
+// registered in w. When the engine does not start, the engine worker replies
+// that it is not available and the machine plays random moves.
+func (m *Main) startBot(w worker.Worker) error {
+	execute := game.UnavailableBotActivity
+	engineErr := m.newBot()
+	if engineErr == nil {
+		botActivity := game.NewBotActivity(m.Bot)
+		botActivity.MoveTime = m.Config.Engine.MoveTime
+		execute = botActivity.Execute
+		w.RegisterActivityWithOptions(execute, activity.RegisterOptions{Name: game.BotActivityName})
+	}
+
+	ew := worker.New(m.Temporal.Client, m.Config.Engine.TaskQueue, worker.Options{
+		Identity:              workerIdentity(m.Config.Engine.TaskQueue),
+		DisableWorkflowWorker: true,
+		WorkerStopTimeout:     m.Config.Shutdown.WorkerTimeout,
+	})
+	ew.RegisterActivityWithOptions(execute, activity.RegisterOptions{Name: game.BotActivityName})
+	if err := ew.Start(); err != nil {
+		return err
+	}
+	m.EngineWorker = ew
+
+	return engineErr
+}
+
+// newBot starts the engine of the in-process bot activity worker.
+func (m *Main) newBot() (err error) {
+	path, err := game.FindEngine(m.Config.Engine.Path)
+	if err != nil {
+		return err
+	}
+
+	protocol, err := game.ParseProtocol(m.Config.Engine.Protocol)
+	if err != nil {
+		return err
+	}
+	config := game.EngineConfig{
+		Path:     path,
+		Args:     m.Config.Engine.Args,
+		Protocol: protocol,
+		Options:  m.Config.Engine.Options,
+	}
+	if m.Bot, err = game.NewBot(config); err != nil {
+		return fmt.Errorf("error starting %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// checkEngineQueues reports the engines requested by name that no worker
+// serves, e.g. cmd/worker uses a different task queue. Games that request
+// them wait for the engine.
+func (m *Main) checkEngineQueues(ctx context.Context, logger logr.Logger) {
+	for name, queue := range m.HTTPServer.EngineTaskQueues {
+		if err := m.Temporal.CheckPoller(ctx, queue, enums.TASK_QUEUE_TYPE_ACTIVITY, ""); err != nil {
+			logger.Info("Engine not served yet", "engine", name, "queue", queue, "reason", err.Error())
+		}
+	}
+}
+
+// registerHealthChecks adds the checks served by /healthz and /readyz.
+func (m *Main) registerHealthChecks() {
+	health := m.DebugServer.Health
+	health.AddLiveness("embedded", m.Temporal.CheckServer)
+	health.AddReadiness("temporal", m.Temporal.CheckConnection)
+
+	queue := m.Config.Temporal.TaskQueue
+	health.AddReadiness("worker", func(ctx context.Context) error {
+		return m.Temporal.CheckPoller(ctx, queue, enums.TASK_QUEUE_TYPE_WORKFLOW, workerIdentity(queue))
+	})
+
+	// Games wait or play random moves without the engine, so its absence is
+	// not a reason to take the server out of the load balancer.
+	if m.EngineWorker != nil {
+		queue := m.Config.Engine.TaskQueue
+		health.AddReadiness("engine-worker", func(ctx context.Context) error {
+			return m.Temporal.CheckPoller(ctx, queue, enums.TASK_QUEUE_TYPE_ACTIVITY, workerIdentity(queue))
+		})
+	}
+}
+
+// workerIdentity identifies the workers of this process in the pollers of
+// their task queue.
+func workerIdentity(queue string) string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%d@%s@%s", os.Getpid(), hostname, queue)
+}
+
+// Close stops the components in order: the HTTP servers drain in-flight
+// requests, then the workers finish their tasks and finally the Temporal client
+// and the embedded server are stopped. Every component is closed even if
+// others fail and their errors are reported together.
 func (m *Main) Close() error {
+	var errs []string
+
 	if m.HTTPServer != nil {
 		if err := m.HTTPServer.Close(); err != nil {
-			return err
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if m.DebugServer != nil {
+		if err := m.DebugServer.Close(); err != nil {
+			errs = append(errs, err.Error())
 		}
 	}
 
@@ -102,11 +314,33 @@ func (m *Main) Close() error {
 		m.TemporalWorker.Stop()
 	}
 
+	if m.EngineWorker != nil {
+		m.EngineWorker.Stop()
+	}
+
+	if m.Bots != nil {
+		m.Bots.Close()
+	}
+
+	if m.Bot != nil {
+		m.Bot.Stop()
+	}
+
 	if m.Temporal != nil {
 		if err := m.Temporal.Close(); err != nil {
-			return err
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if m.Tracer != nil {
+		if err := m.Tracer.Close(); err != nil {
+			errs = append(errs, err.Error())
 		}
 	}
 
+	if len(errs) > 0 {
+		return fmt.Errorf("shutdown failed: %s", strings.Join(errs, "; "))
+	}
+
 	return nil
 }
@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"github.com/sevein/chesstempo/game"
+)
+
+// Allowlist holds the recipients of notifications accepted by the operator.
+// Users choose where their notifications are delivered, so without it the
+// server could be made to post to internal services or to relay mail.
+type Allowlist struct {
+	WebhookHosts []string // Host names, "*.example.com" also matches its subdomains.
+	EmailDomains []string // Domains of the email addresses, same syntax.
+}
+
+// Check returns an error unless every address of the recipient is allowed.
+func (a Allowlist) Check(to game.Recipient) error {
+	if to.Webhook != "" {
+		if err := a.CheckWebhook(to.Webhook); err != nil {
+			return err
+		}
+	}
+	if to.Email != "" {
+		if err := a.CheckEmail(to.Email); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckWebhook accepts HTTP and HTTPS URLs of an allowed host.
+func (a Allowlist) CheckWebhook(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("webhook %q is not an HTTP URL", rawURL)
+	}
+	if u.User != nil {
+		return fmt.Errorf("webhook %q has credentials", rawURL)
+	}
+	if !matchHost(a.WebhookHosts, u.Hostname()) {
+		return fmt.Errorf("webhook host %q is not allowed", u.Hostname())
+	}
+	return nil
+}
+
+// CheckEmail accepts bare addresses, e.g. "user@example.com", of an allowed
+// domain.
+func (a Allowlist) CheckEmail(address string) error {
+	addr, err := mail.ParseAddress(address)
+	if err != nil || addr.Name != "" || addr.Address != address {
+		return fmt.Errorf("email %q is not a valid address", address)
+	}
+	domain := address[strings.LastIndex(address, "@")+1:]
+	if !matchHost(a.EmailDomains, domain) {
+		return fmt.Errorf("email domain %q is not allowed", domain)
+	}
+	return nil
+}
+
+func matchHost(patterns []string, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if strings.HasPrefix(pattern, "*.") {
+			pattern = pattern[2:]
+			if strings.HasSuffix(host, "."+pattern) {
+				return true
+			}
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/smtp"
+
+	"github.com/sevein/chesstempo/game"
+)
+
+// SMTP delivers notifications by email. During development it can point to a
+// local stand-in such as MailHog or smtp4dev.
+type SMTP struct {
+	Addr      string    // Address of the SMTP server, e.g. "127.0.0.1:1025".
+	From      string    // Sender address.
+	Auth      smtp.Auth // Optional authentication mechanism.
+	Allowlist Allowlist // Domains that mail is sent to.
+}
+
+var _ game.Notifier = (*SMTP)(nil)
+
+func (s *SMTP) Notify(ctx context.Context, n game.Notification) error {
+	if n.To.Email == "" || s.Addr == "" {
+		return nil
+	}
+	if err := s.Allowlist.CheckEmail(n.To.Email); err != nil {
+		return err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", n.To.Email)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", n.Subject())
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(n.Body())
+
+	if err := smtp.SendMail(s.Addr, s.Auth, s.From, []string{n.To.Email}, msg.Bytes()); err != nil {
+		return fmt.Errorf("error sending email: %v", err)
+	}
+
+	return nil
+}
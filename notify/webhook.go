@@ -0,0 +1,64 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/sevein/chesstempo/game"
+)
+
+// Webhook delivers notifications as JSON documents posted to the URL chosen by
+// the recipient. URLs and redirects to hosts not in the allowlist are refused.
+type Webhook struct {
+	Client    *http.Client
+	Allowlist Allowlist
+}
+
+var _ game.Notifier = (*Webhook)(nil)
+
+func (wh *Webhook) Notify(ctx context.Context, n game.Notification) error {
+	if n.To.Webhook == "" {
+		return nil
+	}
+	if err := wh.Allowlist.CheckWebhook(n.To.Webhook); err != nil {
+		return err
+	}
+
+	blob, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.To.Webhook, bytes.NewReader(blob))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := http.Client{}
+	if wh.Client != nil {
+		client = *wh.Client
+	}
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("too many redirects")
+		}
+		return wh.Allowlist.CheckWebhook(req.URL.String())
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
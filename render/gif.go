@@ -0,0 +1,196 @@
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/notnil/chess"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// DefaultDelay is the time each move is shown unless ReplayOptions.Delay is
+// set. The final position is shown three times as long.
+const DefaultDelay = time.Second
+
+var (
+	captionColor     = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	captionBackColor = color.RGBA{0x31, 0x2e, 0x2b, 0xff}
+)
+
+// ReplayOptions of the animated replay of a game.
+type ReplayOptions struct {
+	Board    Options       // Options of every frame, Highlight is ignored.
+	Delay    time.Duration // Time each move is shown, DefaultDelay when zero.
+	LastMove bool          // Highlight the last move of every frame.
+	Captions bool          // Write the moves below the board.
+	Result   string        // Appended to the caption of the final position, e.g. "1-0".
+}
+
+func (o ReplayOptions) delay() int {
+	if o.Delay <= 0 {
+		return int(DefaultDelay / (time.Second / 100))
+	}
+	if d := int(o.Delay / (time.Second / 100)); d > 0 {
+		return d
+	}
+	return 1
+}
+
+// GIF writes the replay of the game as an animated GIF, with a frame for the
+// initial position and for each of the moves.
+func GIF(w io.Writer, g *chess.Game, opts ReplayOptions) error {
+	positions, moves := g.Positions(), g.Moves()
+
+	anim := &gif.GIF{}
+	for i, pos := range positions {
+		board := opts.Board
+		board.Highlight = nil
+		if i > 0 && opts.LastMove {
+			board.Highlight = MoveSquares(moves[i-1])
+		}
+
+		img, err := Image(pos, board)
+		if err != nil {
+			return err
+		}
+
+		if opts.Captions {
+			text := ""
+			if i > 0 {
+				text = moveCaption(positions[i-1], moves[i-1])
+			}
+			if i == len(positions)-1 && opts.Result != "" {
+				text = strings.TrimSpace(text + "  " + opts.Result)
+			}
+			if img, err = caption(img, text); err != nil {
+				return err
+			}
+		}
+
+		delay := opts.delay()
+		if i == len(positions)-1 {
+			delay *= 3
+		}
+		anim.Image = append(anim.Image, paletted(img))
+		anim.Delay = append(anim.Delay, delay)
+	}
+
+	if err := gif.EncodeAll(w, anim); err != nil {
+		return fmt.Errorf("error encoding replay: %v", err)
+	}
+
+	return nil
+}
+
+// moveCaption returns the move in SAN preceded by its number, e.g. "1. e4" or
+// "1... e5".
+func moveCaption(pos *chess.Position, m *chess.Move) string {
+	number := 1
+	if fields := strings.Fields(pos.String()); len(fields) == 6 {
+		if n, err := strconv.Atoi(fields[5]); err == nil {
+			number = n
+		}
+	}
+	dots := "."
+	if pos.Turn() == chess.Black {
+		dots = "..."
+	}
+	return fmt.Sprintf("%d%s %s", number, dots, chess.AlgebraicNotation{}.Encode(pos, m))
+}
+
+// caption returns a copy of the board with the text written below it.
+func caption(img *image.RGBA, text string) (*image.RGBA, error) {
+	size := img.Bounds().Dx()
+	height := size / 10
+	if height < 16 {
+		height = 16
+	}
+
+	ret := image.NewRGBA(image.Rect(0, 0, size, size+height))
+	draw.Draw(ret, img.Bounds(), img, image.Point{}, draw.Src)
+	draw.Draw(ret, image.Rect(0, size, size, size+height), image.NewUniform(captionBackColor), image.Point{}, draw.Src)
+
+	face, err := newFace(float64(height) * 0.6)
+	if err != nil {
+		return nil, err
+	}
+	defer face.Close()
+
+	d := &font.Drawer{Dst: ret, Src: image.NewUniform(captionColor), Face: face}
+	x := (fixed.I(size) - d.MeasureString(text)) / 2
+	y := fixed.I(size+height/2) + (face.Metrics().Ascent-face.Metrics().Descent)/2
+	d.Dot = fixed.Point26_6{X: x, Y: y}
+	d.DrawString(text)
+
+	return ret, nil
+}
+
+// paletted converts the image using a palette of its 256 most frequent
+// colors, which include the flat colors of the board. The rest, mostly found
+// in the edges of the pieces, are replaced with the closest ones.
+func paletted(img *image.RGBA) *image.Paletted {
+	counts := map[color.RGBA]int{}
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			counts[img.RGBAAt(x, y)]++
+		}
+	}
+
+	colors := make([]color.RGBA, 0, len(counts))
+	for c := range counts {
+		colors = append(colors, c)
+	}
+	sort.Slice(colors, func(i, j int) bool {
+		ci, cj := counts[colors[i]], counts[colors[j]]
+		if ci != cj {
+			return ci > cj
+		}
+		return rgbaLess(colors[i], colors[j]) // Deterministic output.
+	})
+	if len(colors) > 256 {
+		colors = colors[:256]
+	}
+	pal := make(color.Palette, len(colors))
+	for i, c := range colors {
+		pal[i] = c
+	}
+
+	ret := image.NewPaletted(b, pal)
+	indexes := map[color.RGBA]uint8{}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			idx, ok := indexes[c]
+			if !ok {
+				idx = uint8(pal.Index(c))
+				indexes[c] = idx
+			}
+			ret.SetColorIndex(x, y, idx)
+		}
+	}
+
+	return ret
+}
+
+func rgbaLess(a, b color.RGBA) bool {
+	if a.R != b.R {
+		return a.R < b.R
+	}
+	if a.G != b.G {
+		return a.G < b.G
+	}
+	if a.B != b.B {
+		return a.B < b.B
+	}
+	return a.A < b.A
+}
@@ -0,0 +1,378 @@
+// Package render draws chess positions as SVG and raster images.
+//
+// Boards are described in SVG with squares of 45 units, which is the size of
+// the pieces, and rasterized in pure Go. The pieces are the ones drawn by Colin
+// M.L. Burnett, also used by github.com/notnil/chess/image.
+package render
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/notnil/chess"
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// DefaultSize is the width of the boards in pixels unless Options.Size is set.
+const DefaultSize = 360
+
+// MaxSize bounds the size of the boards.
+const MaxSize = 2048
+
+const (
+	square = 45         // Width of a square in units.
+	board  = square * 8 // Width of the board in units.
+)
+
+var (
+	lightColor     = color.RGBA{0xf0, 0xd9, 0xb5, 0xff}
+	darkColor      = color.RGBA{0xb5, 0x88, 0x63, 0xff}
+	highlightColor = color.RGBA{0x9b, 0xc7, 0x00, 0xff}
+	checkColor     = color.RGBA{0xff, 0x00, 0x00, 0xff}
+	arrowColor     = color.RGBA{0x15, 0x78, 0x1b, 0xff}
+)
+
+// Options of the rendered board.
+type Options struct {
+	Size        int            // Width and height in pixels, DefaultSize when zero.
+	Flip        bool           // Draw the board from Black's side.
+	Coordinates bool           // Draw the ranks and the files.
+	Highlight   []chess.Square // Squares highlighted, e.g. those of the last move.
+	Check       bool           // Highlight the king of the side to move when in check.
+	Arrows      []Arrow
+}
+
+// MoveSquares returns the squares of the move, to be highlighted.
+func MoveSquares(m *chess.Move) []chess.Square {
+	return []chess.Square{m.S1(), m.S2()}
+}
+
+// Arrow is drawn between the centers of two squares.
+type Arrow struct {
+	From, To chess.Square
+}
+
+func (o Options) size() int {
+	switch {
+	case o.Size <= 0:
+		return DefaultSize
+	case o.Size > MaxSize:
+		return MaxSize
+	}
+	return o.Size
+}
+
+// SVG writes the position as an SVG document.
+func SVG(w io.Writer, pos *chess.Position, opts Options) error {
+	_, err := w.Write(document(pos, opts, true))
+	return err
+}
+
+// PNG writes the position as a PNG image.
+func PNG(w io.Writer, pos *chess.Position, opts Options) error {
+	img, err := Image(pos, opts)
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, img)
+}
+
+// Image rasterizes the position.
+func Image(pos *chess.Position, opts Options) (*image.RGBA, error) {
+	size := opts.size()
+
+	// oksvg does not support text, the coordinates are drawn afterwards.
+	icon, err := oksvg.ReadIconStream(bytes.NewReader(document(pos, opts, false)), oksvg.IgnoreErrorMode)
+	if err != nil {
+		return nil, fmt.Errorf("error reading board: %v", err)
+	}
+	icon.SetTarget(0, 0, float64(size), float64(size))
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	scanner := rasterx.NewScannerGV(size, size, img, img.Bounds())
+	icon.Draw(rasterx.NewDasher(size, size, scanner), 1)
+
+	if opts.Coordinates {
+		if err := drawCoordinates(img, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	return img, nil
+}
+
+// document describes the board in SVG, including the coordinates when text
+// is set.
+func document(pos *chess.Position, opts Options, text bool) []byte {
+	b := &bytes.Buffer{}
+	size := opts.size()
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d">`, size, size, board, board)
+	b.WriteString("\n")
+
+	for i := 0; i < 64; i++ {
+		sq := chess.Square(i)
+		x, y := xy(sq, opts.Flip)
+		fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`+"\n", x, y, square, square, hex(squareColor(sq)))
+	}
+
+	for _, sq := range opts.Highlight {
+		x, y := xy(sq, opts.Flip)
+		fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" fill-opacity="0.4"/>`+"\n", x, y, square, square, hex(highlightColor))
+	}
+
+	if opts.Check {
+		if sq, ok := checkedKing(pos); ok {
+			x, y := xy(sq, opts.Flip)
+			fmt.Fprintf(b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s" fill-opacity="0.5"/>`+"\n", x, y, square, square, hex(checkColor))
+		}
+	}
+
+	if text && opts.Coordinates {
+		for _, c := range coordinates(opts.Flip) {
+			anchor := "start"
+			if c.right {
+				anchor = "end"
+			}
+			fmt.Fprintf(b, `<text x="%.1f" y="%.1f" font-family="sans-serif" font-weight="bold" font-size="%d" text-anchor="%s" fill="%s">%s</text>`+"\n",
+				c.x, c.y, fontSize, anchor, hex(c.color), c.text)
+		}
+	}
+
+	pieces := pos.Board().SquareMap()
+	for i := 0; i < 64; i++ {
+		sq := chess.Square(i)
+		if p, ok := pieces[sq]; ok && p != chess.NoPiece {
+			x, y := xy(sq, opts.Flip)
+			fmt.Fprintf(b, `<g transform="translate(%d,%d)">%s</g>`+"\n", x, y, pieceSVG(p))
+		}
+	}
+
+	for _, a := range opts.Arrows {
+		if a.From == a.To {
+			continue
+		}
+		fmt.Fprintf(b, `<polygon points="%s" fill="%s" fill-opacity="0.8"/>`+"\n", arrowPoints(a, opts.Flip), hex(arrowColor))
+	}
+
+	b.WriteString("</svg>\n")
+
+	return b.Bytes()
+}
+
+// xy returns the position of the top left corner of the square.
+func xy(sq chess.Square, flip bool) (x, y int) {
+	file, rank := int(sq.File()), 7-int(sq.Rank())
+	if flip {
+		file, rank = 7-file, 7-rank
+	}
+	return file * square, rank * square
+}
+
+func squareColor(sq chess.Square) color.Color {
+	if (int(sq.File())+int(sq.Rank()))%2 == 0 {
+		return darkColor
+	}
+	return lightColor
+}
+
+func hex(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
+
+// arrowPoints returns the outline of an arrow pointing at the center of the
+// target square.
+func arrowPoints(a Arrow, flip bool) string {
+	x1, y1 := xy(a.From, flip)
+	x2, y2 := xy(a.To, flip)
+	fx, fy := float64(x1)+square/2, float64(y1)+square/2
+	tx, ty := float64(x2)+square/2, float64(y2)+square/2
+
+	const (
+		shaft = square * 0.2  // Width of the shaft.
+		head  = square * 0.55 // Width of the head.
+		tip   = square * 0.45 // Length of the head.
+	)
+	length := math.Hypot(tx-fx, ty-fy)
+	dx, dy := (tx-fx)/length, (ty-fy)/length // Direction.
+	nx, ny := -dy, dx                        // Normal.
+	bx, by := tx-dx*tip, ty-dy*tip           // Base of the head.
+
+	points := [][2]float64{
+		{fx + nx*shaft/2, fy + ny*shaft/2},
+		{bx + nx*shaft/2, by + ny*shaft/2},
+		{bx + nx*head/2, by + ny*head/2},
+		{tx, ty},
+		{bx - nx*head/2, by - ny*head/2},
+		{bx - nx*shaft/2, by - ny*shaft/2},
+		{fx - nx*shaft/2, fy - ny*shaft/2},
+	}
+	ret := make([]string, len(points))
+	for i, p := range points {
+		ret[i] = fmt.Sprintf("%.2f,%.2f", p[0], p[1])
+	}
+	return strings.Join(ret, " ")
+}
+
+// checkedKing returns the square of the king of the side to move when it is
+// in check. The position is inspected from the side of the opponent, which
+// can capture the king when it is in check.
+func checkedKing(pos *chess.Position) (chess.Square, bool) {
+	turn := pos.Turn()
+
+	target := chess.NoSquare
+	for sq, p := range pos.Board().SquareMap() {
+		if p.Type() == chess.King && p.Color() == turn {
+			target = sq
+		}
+	}
+	if target == chess.NoSquare {
+		return target, false
+	}
+
+	fields := strings.Fields(pos.String())
+	if len(fields) != 6 {
+		return target, false
+	}
+	fields[1] = turn.Other().String()
+	fields[3] = "-"
+	fen, err := chess.FEN(strings.Join(fields, " "))
+	if err != nil {
+		return target, false
+	}
+	for _, m := range chess.NewGame(fen).Position().ValidMoves() {
+		if m.S2() == target {
+			return target, true
+		}
+	}
+
+	return target, false
+}
+
+//go:embed pieces/*.svg
+var pieceFiles embed.FS
+
+var pieceSymbols = map[chess.PieceType]string{
+	chess.King:   "K",
+	chess.Queen:  "Q",
+	chess.Rook:   "R",
+	chess.Bishop: "B",
+	chess.Knight: "N",
+	chess.Pawn:   "P",
+}
+
+// pieceSVG returns the contents of the SVG document of the piece.
+func pieceSVG(p chess.Piece) string {
+	blob, err := pieceFiles.ReadFile(fmt.Sprintf("pieces/%s%s.svg", p.Color(), pieceSymbols[p.Type()]))
+	if err != nil {
+		return ""
+	}
+	doc := string(blob)
+	start, end := strings.Index(doc, ">"), strings.LastIndex(doc, "</svg>")
+	if start < 0 || end < start {
+		return ""
+	}
+	return strings.TrimSpace(doc[start+1 : end])
+}
+
+const fontSize = 10 // In units.
+
+type coordinate struct {
+	text  string
+	x, y  float64
+	right bool // Right-aligned.
+	color color.Color
+}
+
+// coordinates returns the ranks, drawn in the left column, and the files,
+// drawn in the bottom row. They use the color of the opposite squares.
+func coordinates(flip bool) []coordinate {
+	ret := []coordinate{}
+	for i := 0; i < 8; i++ {
+		left := chess.NewSquare(chess.FileA, chess.Rank(7-i))
+		bottom := chess.NewSquare(chess.File(i), chess.Rank1)
+		if flip {
+			left = chess.NewSquare(chess.FileH, chess.Rank(i))
+			bottom = chess.NewSquare(chess.File(7-i), chess.Rank8)
+		}
+		ret = append(ret,
+			coordinate{
+				text:  left.Rank().String(),
+				x:     2,
+				y:     float64(i*square) + fontSize + 1,
+				color: textColor(left),
+			},
+			coordinate{
+				text:  bottom.File().String(),
+				x:     float64((i+1)*square) - 2,
+				y:     board - 3,
+				right: true,
+				color: textColor(bottom),
+			},
+		)
+	}
+	return ret
+}
+
+func textColor(sq chess.Square) color.Color {
+	if squareColor(sq) == darkColor {
+		return lightColor
+	}
+	return darkColor
+}
+
+var (
+	fontOnce sync.Once
+	fontData *opentype.Font
+	fontErr  error
+)
+
+// newFace returns the font used to draw text of the given size in pixels.
+func newFace(size float64) (font.Face, error) {
+	fontOnce.Do(func() {
+		fontData, fontErr = opentype.Parse(gobold.TTF)
+	})
+	if fontErr != nil {
+		return nil, fontErr
+	}
+	return opentype.NewFace(fontData, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+}
+
+// drawCoordinates draws the coordinates on the rasterized board.
+func drawCoordinates(img *image.RGBA, opts Options) error {
+	scale := float64(opts.size()) / board
+	face, err := newFace(fontSize * scale)
+	if err != nil {
+		return err
+	}
+	defer face.Close()
+
+	for _, c := range coordinates(opts.Flip) {
+		d := &font.Drawer{Dst: img, Src: image.NewUniform(c.color), Face: face}
+		x := c.x * scale
+		if c.right {
+			x -= float64(d.MeasureString(c.text)) / 64
+		}
+		d.Dot = fixed.Point26_6{X: fixed.Int26_6(x * 64), Y: fixed.Int26_6(c.y * scale * 64)}
+		d.DrawString(c.text)
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package render_test
+
+import (
+	"bytes"
+	"image/gif"
+	"image/png"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/notnil/chess"
+
+	"github.com/sevein/chesstempo/render"
+)
+
+func TestSVG(t *testing.T) {
+	t.Parallel()
+
+	// Fool's mate, the white king is in check.
+	fen, err := chess.FEN("rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos := chess.NewGame(fen).Position()
+
+	b := &bytes.Buffer{}
+	opts := render.Options{Coordinates: true, Check: true, Arrows: []render.Arrow{{From: chess.E1, To: chess.F2}}}
+	if err := render.SVG(b, pos, opts); err != nil {
+		t.Fatal(err)
+	}
+	doc := b.String()
+
+	if n := strings.Count(doc, "<g transform="); n != 32 {
+		t.Errorf("got %d pieces, want 32", n)
+	}
+	if !strings.Contains(doc, `x="180" y="315" width="45" height="45" fill="#ff0000"`) {
+		t.Errorf("king in check is not highlighted")
+	}
+	if n := strings.Count(doc, "<polygon"); n != 1 {
+		t.Errorf("got %d arrows, want 1", n)
+	}
+	if n := strings.Count(doc, "<text"); n != 16 {
+		t.Errorf("got %d coordinates, want 16", n)
+	}
+}
+
+func TestPNG(t *testing.T) {
+	t.Parallel()
+
+	b := &bytes.Buffer{}
+	opts := render.Options{Size: 100, Flip: true, Coordinates: true, Highlight: []chess.Square{chess.E2, chess.E4}}
+	if err := render.PNG(b, chess.NewGame().Position(), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size.X != 100 || size.Y != 100 {
+		t.Errorf("got size %v, want 100x100", size)
+	}
+}
+
+func TestGIF(t *testing.T) {
+	t.Parallel()
+
+	g := chess.NewGame()
+	for _, m := range []string{"f3", "e5", "g4", "Qh4#"} {
+		if err := g.MoveStr(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b := &bytes.Buffer{}
+	opts := render.ReplayOptions{
+		Board:    render.Options{Size: 100, Check: true},
+		Delay:    time.Second / 2,
+		LastMove: true,
+		Captions: true,
+		Result:   "0-1",
+	}
+	if err := render.GIF(b, g, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	anim, err := gif.DecodeAll(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{50, 50, 50, 50, 150}; !reflect.DeepEqual(anim.Delay, want) {
+		t.Errorf("got delays %v, want %v", anim.Delay, want)
+	}
+	if size := anim.Image[0].Bounds().Size(); size.X != 100 || size.Y != 116 {
+		t.Errorf("got size %v, want 100x116", size)
+	}
+}
@@ -0,0 +1,78 @@
+package temporal
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// TLS configures the connection with an external cluster. A client
+// certificate enables mutual TLS.
+type TLS struct {
+	CertFile   string
+	KeyFile    string
+	CAFile     string // Defaults to the system pool.
+	ServerName string // Overrides the name used to verify the server.
+}
+
+func (t TLS) enabled() bool {
+	return t != TLS{}
+}
+
+func (t TLS) Validate() error {
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return errors.New("TLS certificate and key must be provided together")
+	}
+
+	return nil
+}
+
+// Config loads the certificates and returns the resulting tls.Config.
+func (t TLS) Config() (*tls.Config, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		ServerName: t.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if t.CAFile != "" {
+		blob, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(blob) {
+			return nil, fmt.Errorf("no certificates found in %s", t.CAFile)
+		}
+		config.RootCAs = pool
+	}
+
+	return config, nil
+}
+
+// Credentials provides the gRPC headers sent with every request.
+type Credentials interface {
+	GetHeaders(ctx context.Context) (map[string]string, error)
+}
+
+// APIKey is a credentials provider that authenticates every request to the
+// cluster with a bearer token.
+type APIKey string
+
+func (k APIKey) GetHeaders(ctx context.Context) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(k)}, nil
+}
@@ -0,0 +1,63 @@
+package temporal
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/workflowservice/v1"
+)
+
+// CheckConnection checks that the frontend service can be reached.
+func (c *Client) CheckConnection(ctx context.Context) error {
+	if _, err := c.Client.WorkflowService().GetSystemInfo(ctx, &workflowservice.GetSystemInfoRequest{}); err != nil {
+		return fmt.Errorf("frontend unavailable: %v", err)
+	}
+
+	return nil
+}
+
+// CheckServer checks that the frontend of the embedded server accepts
+// connections. It does nothing when using an external cluster.
+func (c *Client) CheckServer(ctx context.Context) error {
+	if c.Server == nil {
+		return nil
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", c.Server.FrontendHostPort())
+	if err != nil {
+		return fmt.Errorf("embedded server unavailable: %v", err)
+	}
+
+	return conn.Close()
+}
+
+// pollerInterval is longer than the long poll of the workers, so an idle
+// worker is not reported as missing.
+const pollerInterval = time.Minute * 2
+
+// CheckPoller checks that the worker with the given identity, or any worker
+// when it is empty, has recently polled the task queue.
+func (c *Client) CheckPoller(ctx context.Context, queue string, kind enums.TaskQueueType, identity string) error {
+	resp, err := c.Client.DescribeTaskQueue(ctx, queue, kind)
+	if err != nil {
+		return fmt.Errorf("error describing task queue %s: %v", queue, err)
+	}
+
+	for _, poller := range resp.Pollers {
+		if (identity != "" && poller.Identity != identity) || poller.LastAccessTime == nil {
+			continue
+		}
+		if time.Since(*poller.LastAccessTime) < pollerInterval {
+			return nil
+		}
+	}
+
+	if identity == "" {
+		return fmt.Errorf("no worker is polling task queue %s", queue)
+	}
+	return fmt.Errorf("worker %s is not polling task queue %s", identity, queue)
+}
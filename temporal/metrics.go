@@ -0,0 +1,47 @@
+package temporal
+
+import (
+	"io"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/uber-go/tally/v4"
+	tallyprom "github.com/uber-go/tally/v4/prometheus"
+	"go.temporal.io/sdk/client"
+)
+
+// newMetricsHandler returns a handler that reports the metrics of the SDK to
+// the Prometheus registerer. The closer flushes and stops the reporter.
+func newMetricsHandler(registerer prometheus.Registerer) (client.MetricsHandler, io.Closer) {
+	reporter := tallyprom.NewReporter(tallyprom.Options{
+		Registerer: registerer,
+	})
+	scope, closer := tally.NewRootScope(tally.ScopeOptions{
+		CachedReporter:  reporter,
+		Separator:       tallyprom.DefaultSeparator,
+		SanitizeOptions: &tallyprom.DefaultSanitizerOpts,
+	}, time.Second)
+
+	return metricsHandler{scope}, closer
+}
+
+// metricsHandler adapts a tally scope to the metrics handler of the SDK.
+type metricsHandler struct {
+	scope tally.Scope
+}
+
+func (h metricsHandler) WithTags(tags map[string]string) client.MetricsHandler {
+	return metricsHandler{h.scope.Tagged(tags)}
+}
+
+func (h metricsHandler) Counter(name string) client.MetricsCounter {
+	return h.scope.Counter(name)
+}
+
+func (h metricsHandler) Gauge(name string) client.MetricsGauge {
+	return h.scope.Gauge(name)
+}
+
+func (h metricsHandler) Timer(name string) client.MetricsTimer {
+	return h.scope.Timer(name)
+}
@@ -4,15 +4,23 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/DataDog/temporalite"
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.temporal.io/api/enums/v1"
 	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/workflow"
+	"go.temporal.io/server/api/adminservice/v1"
 	"go.temporal.io/server/common/log/tag"
 	"go.temporal.io/server/temporal"
+	"google.golang.org/grpc"
 )
 
 type Client struct {
@@ -21,6 +29,30 @@ type Client struct {
 	Namespace string
 	Server    *temporalite.Server
 	Client    client.Client
+
+	// Connection options of an external cluster. HostPort defaults to the
+	// local frontend and Credentials, if set, adds headers to every request.
+	HostPort    string
+	TLS         TLS
+	Credentials Credentials
+
+	// Options of the embedded server. The frontend listens on a free port
+	// unless FrontendPort is set and the database is stored in the user
+	// config dir unless DatabasePath is set.
+	FrontendPort int
+	DatabasePath string
+
+	// Propagators of the context of workflows and activities, e.g. tracing.
+	ContextPropagators []workflow.ContextPropagator
+
+	// Registerer of the metrics emitted by the SDK, nil disables them.
+	Metrics prometheus.Registerer
+	metrics io.Closer
+
+	// Custom search attributes registered in the embedded server. They must
+	// be registered by the operator when using an external cluster, which is
+	// checked when connecting.
+	SearchAttributes map[string]enums.IndexedValueType
 }
 
 func New() *Client {
@@ -32,12 +64,19 @@ func (c *Client) Create(logger logr.Logger) (err error) {
 		return errors.New("namespace is undefined")
 	}
 
-	opts := client.Options{
-		Namespace: c.Namespace,
-		Logger:    clientLogger{logger},
+	var handler client.MetricsHandler
+	if c.Metrics != nil {
+		handler, c.metrics = newMetricsHandler(c.Metrics)
 	}
 
 	if c.Embedded {
+		opts := client.Options{
+			Namespace:          c.Namespace,
+			Logger:             clientLogger{logger},
+			MetricsHandler:     handler,
+			ContextPropagators: c.ContextPropagators,
+		}
+
 		if err := c.embedTemporal(logger.WithName("server")); err != nil {
 			return fmt.Errorf("error starting temporalite: %v", err)
 		}
@@ -50,13 +89,61 @@ func (c *Client) Create(logger logr.Logger) (err error) {
 		if c.Client, err = c.Server.NewClientWithOptions(ctx, opts); err != nil {
 			return err
 		}
-	} else if c.Client, err = client.NewClient(opts); err != nil {
-		return err
+
+		if err := c.registerSearchAttributes(ctx); err != nil {
+			return fmt.Errorf("error registering search attributes: %v", err)
+		}
+	} else {
+		opts, err := c.Options(logger)
+		if err != nil {
+			return err
+		}
+		opts.MetricsHandler = handler
+		if c.Client, err = client.NewClient(opts); err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		missing, err := c.missingSearchAttributes(ctx)
+		if err != nil {
+			return fmt.Errorf("error reading search attributes: %v", err)
+		}
+		if len(missing) > 0 {
+			names := make([]string, 0, len(missing))
+			for name, kind := range missing {
+				names = append(names, name+" ("+kind.String()+")")
+			}
+			sort.Strings(names)
+			return fmt.Errorf("search attributes not registered in namespace %s: %s", c.Namespace, strings.Join(names, ", "))
+		}
 	}
 
 	return nil
 }
 
+// Options returns the options used to connect to an external cluster.
+func (c *Client) Options(logger logr.Logger) (client.Options, error) {
+	opts := client.Options{
+		HostPort:           c.HostPort,
+		Namespace:          c.Namespace,
+		Logger:             clientLogger{logger},
+		HeadersProvider:    c.Credentials,
+		ContextPropagators: c.ContextPropagators,
+	}
+
+	if c.TLS.enabled() {
+		config, err := c.TLS.Config()
+		if err != nil {
+			return opts, err
+		}
+		opts.ConnectionOptions.TLS = config
+	}
+
+	return opts, nil
+}
+
 func (c *Client) Close() error {
 	if c.Client != nil {
 		c.Client.Close()
@@ -66,27 +153,37 @@ func (c *Client) Close() error {
 		c.Server.Stop()
 	}
 
+	if c.metrics != nil {
+		return c.metrics.Close()
+	}
+
 	return nil
 }
 
 func (c *Client) embedTemporal(logger logr.Logger) (err error) {
 	opts := []temporalite.ServerOption{
 		temporalite.WithNamespaces(c.Namespace),
-		temporalite.WithFrontendPort(11111),
 		temporalite.WithUpstreamOptions(
 			temporal.WithLogger(serverLogger{logger}),
 		),
 	}
+	if c.FrontendPort > 0 {
+		opts = append(opts, temporalite.WithFrontendPort(c.FrontendPort))
+	} else {
+		opts = append(opts, temporalite.WithDynamicPorts())
+	}
 	if c.Ephemeral {
 		opts = append(opts, temporalite.WithPersistenceDisabled())
 	} else {
-		configDir, err := os.UserConfigDir()
-		if err != nil {
-			return err
+		path := c.DatabasePath
+		if path == "" {
+			configDir, err := os.UserConfigDir()
+			if err != nil {
+				return err
+			}
+			path = filepath.Join(configDir, "temporalite.db")
 		}
-		opts = append(opts, temporalite.WithDatabaseFilePath(
-			filepath.Join(configDir, "temporalite.db"),
-		))
+		opts = append(opts, temporalite.WithDatabaseFilePath(path))
 	}
 
 	c.Server, err = temporalite.NewServer(opts...)
@@ -99,28 +196,73 @@ func (c *Client) embedTemporal(logger logr.Logger) (err error) {
 	return nil
 }
 
+// missingSearchAttributes returns the custom search attributes that are not
+// known by the server.
+func (c *Client) missingSearchAttributes(ctx context.Context) (map[string]enums.IndexedValueType, error) {
+	resp, err := c.Client.GetSearchAttributes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := map[string]enums.IndexedValueType{}
+	for name, kind := range c.SearchAttributes {
+		if _, ok := resp.Keys[name]; !ok {
+			missing[name] = kind
+		}
+	}
+
+	return missing, nil
+}
+
+// registerSearchAttributes adds the custom search attributes that are not
+// known by the embedded server yet.
+func (c *Client) registerSearchAttributes(ctx context.Context) error {
+	missing, err := c.missingSearchAttributes(ctx)
+	if err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	conn, err := grpc.DialContext(ctx, c.Server.FrontendHostPort(), grpc.WithInsecure())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = adminservice.NewAdminServiceClient(conn).AddSearchAttributes(ctx, &adminservice.AddSearchAttributesRequest{
+		SearchAttributes: missing,
+		SkipSchemaUpdate: true,
+	})
+
+	return err
+}
+
 // clientLogger wraps the application logger for compatibility with Temporal.
+// Warnings are always shown since logr has no warning level.
 type clientLogger struct {
 	logger logr.Logger
 }
 
 func (l clientLogger) Debug(msg string, keyvals ...interface{}) {
-	l.logger.V(8).Info(msg, keyvals...)
+	l.logger.V(2).Info(msg, keyvals...)
 }
 
 func (l clientLogger) Info(msg string, keyvals ...interface{}) {
-	l.logger.V(7).Info(msg, keyvals...)
+	l.logger.V(1).Info(msg, keyvals...)
 }
 
 func (l clientLogger) Warn(msg string, keyvals ...interface{}) {
-	l.logger.V(6).Info(msg, keyvals...)
+	l.logger.Info(msg, keyvals...)
 }
 
 func (l clientLogger) Error(msg string, keyvals ...interface{}) {
-	l.logger.V(5).Info(msg, keyvals...)
+	l.logger.Error(nil, msg, keyvals...)
 }
 
 // serverLogger wraps the application logger for compatibility with Temporal.
+// The embedded server is chatty, so only its errors are shown by default.
 type serverLogger struct {
 	logger logr.Logger
 }
@@ -138,17 +280,17 @@ func (l serverLogger) Debug(msg string, tags ...tag.Tag) {
 }
 
 func (l serverLogger) Info(msg string, tags ...tag.Tag) {
-	l.logger.V(8).Info(msg, l.kv(msg, tags)...)
+	l.logger.V(7).Info(msg, l.kv(msg, tags)...)
 }
 
 func (l serverLogger) Warn(msg string, tags ...tag.Tag) {
-	l.logger.V(8).Info(msg, l.kv(msg, tags)...)
+	l.logger.V(3).Info(msg, l.kv(msg, tags)...)
 }
 
 func (l serverLogger) Error(msg string, tags ...tag.Tag) {
-	l.logger.V(8).Info(msg, l.kv(msg, tags)...)
+	l.logger.Error(nil, msg, l.kv(msg, tags)...)
 }
 
 func (l serverLogger) Fatal(msg string, tags ...tag.Tag) {
-	l.logger.V(8).Info(msg, l.kv(msg, tags)...)
+	l.logger.Error(nil, msg, l.kv(msg, tags)...)
 }
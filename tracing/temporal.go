@@ -0,0 +1,107 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/workflow"
+)
+
+// headerKey is the Temporal header that carries the trace context.
+const headerKey = "chesstempo-trace"
+
+type carrierKey struct{}
+
+// propagator propagates the trace context in the headers of workflows and
+// activities. Workflows keep the context as a carrier, since spans cannot be
+// stored in the deterministic workflow context.
+type propagator struct{}
+
+func NewContextPropagator() workflow.ContextPropagator {
+	return propagator{}
+}
+
+func (propagator) Inject(ctx context.Context, writer workflow.HeaderWriter) error {
+	return write(writer, Inject(ctx))
+}
+
+func (propagator) Extract(ctx context.Context, reader workflow.HeaderReader) (context.Context, error) {
+	carrier, err := read(reader)
+	if err != nil || carrier == nil {
+		return ctx, err
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, carrier), nil
+}
+
+func (propagator) InjectFromWorkflow(ctx workflow.Context, writer workflow.HeaderWriter) error {
+	carrier, _ := ctx.Value(carrierKey{}).(propagation.MapCarrier)
+	return write(writer, carrier)
+}
+
+func (propagator) ExtractToWorkflow(ctx workflow.Context, reader workflow.HeaderReader) (workflow.Context, error) {
+	carrier, err := read(reader)
+	if err != nil || carrier == nil {
+		return ctx, err
+	}
+	return workflow.WithValue(ctx, carrierKey{}, carrier), nil
+}
+
+func write(writer workflow.HeaderWriter, carrier map[string]string) error {
+	if len(carrier) == 0 {
+		return nil
+	}
+
+	payload, err := converter.GetDefaultDataConverter().ToPayload(carrier)
+	if err != nil {
+		return err
+	}
+	writer.Set(headerKey, payload)
+
+	return nil
+}
+
+func read(reader workflow.HeaderReader) (propagation.MapCarrier, error) {
+	payload, ok := reader.Get(headerKey)
+	if !ok {
+		return nil, nil
+	}
+
+	var carrier propagation.MapCarrier
+	if err := converter.GetDefaultDataConverter().FromPayload(payload, &carrier); err != nil {
+		return nil, err
+	}
+
+	return carrier, nil
+}
+
+// WithCarrier returns a workflow context that carries the given trace context,
+// e.g. received in a signal. Activities scheduled with it join the trace.
+func WithCarrier(ctx workflow.Context, carrier map[string]string) workflow.Context {
+	if len(carrier) == 0 {
+		return ctx
+	}
+	return workflow.WithValue(ctx, carrierKey{}, propagation.MapCarrier(carrier))
+}
+
+// StartWorkflowSpan starts a span in the trace carried by the workflow
+// context. Nothing is recorded while the history is replayed, so the span is
+// not duplicated when the workflow is recovered by another worker.
+func StartWorkflowSpan(ctx workflow.Context, name string, attrs ...attribute.KeyValue) (workflow.Context, func()) {
+	if workflow.IsReplaying(ctx) {
+		return ctx, func() {}
+	}
+
+	carrier, _ := ctx.Value(carrierKey{}).(propagation.MapCarrier)
+	if carrier == nil {
+		carrier = propagation.MapCarrier{}
+	}
+	parent := otel.GetTextMapPropagator().Extract(context.Background(), carrier)
+
+	spanCtx, span := Start(parent, name, attrs...)
+	ctx = WithCarrier(ctx, Inject(spanCtx))
+
+	return ctx, func() { span.End() }
+}
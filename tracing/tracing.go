@@ -0,0 +1,119 @@
+// Package tracing configures OpenTelemetry and propagates the trace context
+// through Temporal, so a request can be followed from the HTTP API into the
+// game workflow and the engine activity.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterNone   = ""
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// Tracer sets up the global tracer provider. Spans are discarded unless an
+// exporter is configured.
+type Tracer struct {
+	ServiceName string
+	Exporter    string
+	Endpoint    string // OTLP endpoint, defaults to localhost:4317.
+	Insecure    bool   // Disables TLS with the OTLP endpoint.
+
+	provider *sdktrace.TracerProvider
+}
+
+func New() *Tracer {
+	return &Tracer{ServiceName: "chesstempo"}
+}
+
+func (t *Tracer) Open() error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch t.Exporter {
+	case ExporterNone:
+		return nil
+	case ExporterOTLP:
+		opts := []otlptracegrpc.Option{}
+		if t.Endpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(t.Endpoint))
+		}
+		if t.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(context.Background(), opts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	default:
+		return fmt.Errorf("unknown exporter %q", t.Exporter)
+	}
+	if err != nil {
+		return fmt.Errorf("error creating %s exporter: %v", t.Exporter, err)
+	}
+
+	t.provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", t.ServiceName),
+		)),
+	)
+	otel.SetTracerProvider(t.provider)
+
+	return nil
+}
+
+// Close flushes the spans that have not been exported yet.
+func (t *Tracer) Close() error {
+	if t.provider == nil {
+		return nil
+	}
+
+	if err := t.provider.Shutdown(context.Background()); err != nil {
+		return fmt.Errorf("error shutting down tracer: %v", err)
+	}
+
+	return nil
+}
+
+func Validate(exporter string) error {
+	switch exporter {
+	case ExporterNone, ExporterOTLP, ExporterStdout:
+		return nil
+	}
+	return errors.New("tracing exporter must be otlp or stdout")
+}
+
+// Start starts a span using the global tracer provider.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer("github.com/sevein/chesstempo").Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// Inject returns the trace context of ctx, e.g. to send it in a signal.
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}